@@ -1,12 +1,14 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"neecache"
 	"net/http"
 	"strings"
+	"time"
 )
 
 var db = map[string]string{
@@ -16,15 +18,18 @@ var db = map[string]string{
 }
 
 func createGroup() *neecache.Group {
-	return neecache.NewGroup("sources", 2<<10, neecache.GetterFunc(
+	nee := neecache.NewGroup("sources", 2<<10, neecache.GetterFunc(
 		func(key string) ([]byte, error) {
 			log.Println("[SlowDB] search key", key)
 			if v, ok := db[key]; ok {
 				return []byte(v), nil
 			}
-			return nil, fmt.Errorf("%s not exist", key)
+			return nil, fmt.Errorf("%s not exist: %w", key, neecache.ErrNotFound)
 		},
 	))
+	// 不存在的 key 在一分钟内不再访问数据源
+	nee.SetNegativeTTL(time.Minute)
+	return nee
 }
 
 func getUrlIndex(addr string, index int) int {
@@ -32,6 +37,9 @@ func getUrlIndex(addr string, index int) int {
 		index = index + 7
 	} else if index = strings.Index(addr, "https://"); index != -1 {
 		index += 8
+	} else {
+		// 没有协议前缀时使用整个地址
+		index = 0
 	}
 	return index
 }
@@ -57,7 +65,11 @@ func startAPIServer(apiAddr string, nee *neecache.Group) {
 	http.Handle("/api", http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			key := r.URL.Query().Get("key")
-			view, err := nee.Get(key)
+			view, err := nee.GetContext(r.Context(), key)
+			if errors.Is(err, neecache.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
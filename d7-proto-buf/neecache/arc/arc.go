@@ -0,0 +1,271 @@
+package arc
+
+import (
+	"container/list"
+	"neecache/internal/queue"
+	"neecache/lru"
+	"time"
+)
+
+// Cache is an ARC (Adaptive Replacement Cache). It is not safe for concurrent access.
+// ARC 同时维护两条 LRU 链表：t1 保存只访问过一次的节点，t2 保存访问过多次的节点；
+// b1、b2 分别记录从 t1、t2 淘汰的键（ghost，只保留键和大小，不保留值）。
+// 命中 b1 说明 t1 太小，命中 b2 说明 t2 太小，据此自适应地调整 t1 的目标大小 p，
+// 因此一次性的大范围扫描只会冲刷 t1，不会淘汰 t2 中的热点数据。
+// 与论文中按条目计数不同，这里的容量与 p 都以字节计算。
+type Cache struct {
+	maxBytes int64 // 允许使用的最大内存
+	p        int64 // t1 的目标字节数
+	t1, t2   *queue.Queue
+	b1, b2   *queue.Queue
+	// optional and executed when an entry is purged
+	OnEvicted func(key string, value lru.Value, reason lru.EvictReason)
+	now       func() time.Time
+}
+
+// New is the constructor of Cache
+func New(maxBytes int64, onEvicted func(string, lru.Value, lru.EvictReason)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		t1:        queue.New(),
+		t2:        queue.New(),
+		b1:        queue.New(),
+		b2:        queue.New(),
+		OnEvicted: onEvicted,
+		now:       time.Now,
+	}
+}
+
+// Get look ups a key`s value
+func (c *Cache) Get(key string) (value lru.Value, ok bool) {
+	if ele, ok := c.t1.Lookup(key); ok {
+		e := ele.Value.(*queue.Entry)
+		if e.Expired(c.now()) {
+			c.evict(c.t1, ele, lru.EvictExpired)
+			return nil, false
+		}
+		// 第二次访问，从 t1 提升到 t2
+		c.t1.Remove(ele)
+		c.t2.PushFront(e)
+		return e.Value, true
+	}
+	if ele, ok := c.t2.Lookup(key); ok {
+		e := ele.Value.(*queue.Entry)
+		if e.Expired(c.now()) {
+			c.evict(c.t2, ele, lru.EvictExpired)
+			return nil, false
+		}
+		c.t2.MoveToFront(ele)
+		return e.Value, true
+	}
+	return
+}
+
+// Add adds a value to the cache.
+func (c *Cache) Add(key string, value lru.Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithTTL adds a value to the cache which expires after ttl.
+// A non-positive ttl means the value never expires.
+func (c *Cache) AddWithTTL(key string, value lru.Value, ttl time.Duration) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = c.now().Add(ttl)
+	}
+	c.AddWithExpire(key, value, expire)
+}
+
+// AddWithExpire adds a value to the cache which expires at the given time.
+// A zero expire means the value never expires.
+func (c *Cache) AddWithExpire(key string, value lru.Value, expire time.Time) {
+	e := &queue.Entry{Key: key, Value: value, Size: int64(len(key)) + int64(value.Len()), Expire: expire}
+
+	// 已缓存的键：更新值并提升到 t2
+	if ele, ok := c.t1.Lookup(key); ok {
+		c.t1.Remove(ele)
+		c.t2.PushFront(e)
+		c.trim()
+		return
+	}
+	if ele, ok := c.t2.Lookup(key); ok {
+		c.t2.Remove(ele)
+		c.t2.PushFront(e)
+		c.trim()
+		return
+	}
+
+	// 命中 b1：t1 太小，增大 p
+	if ele, ok := c.b1.Lookup(key); ok {
+		delta := e.Size
+		if c.b1.Bytes() > 0 && c.b2.Bytes() > c.b1.Bytes() {
+			delta = e.Size * (c.b2.Bytes() / c.b1.Bytes())
+		}
+		c.p = min64(c.p+delta, c.maxBytes)
+		c.b1.Remove(ele)
+		c.replace(e.Size, false)
+		c.t2.PushFront(e)
+		c.trim()
+		return
+	}
+
+	// 命中 b2：t2 太小，减小 p
+	if ele, ok := c.b2.Lookup(key); ok {
+		delta := e.Size
+		if c.b2.Bytes() > 0 && c.b1.Bytes() > c.b2.Bytes() {
+			delta = e.Size * (c.b1.Bytes() / c.b2.Bytes())
+		}
+		c.p = max64(c.p-delta, 0)
+		c.b2.Remove(ele)
+		c.replace(e.Size, true)
+		c.t2.PushFront(e)
+		c.trim()
+		return
+	}
+
+	// 全新的键，加入 t1
+	c.replace(e.Size, false)
+	c.t1.PushFront(e)
+	c.trim()
+}
+
+// replace 在插入 size 字节前，按照 p 从 t1 或 t2 淘汰节点到对应的 ghost 链表
+func (c *Cache) replace(size int64, inB2 bool) {
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.t1.Len()+c.t2.Len() > 0 && c.t1.Bytes()+c.t2.Bytes()+size > c.maxBytes {
+		c.removeOldest(inB2)
+	}
+}
+
+// RemoveOldest evicts the least recently used item of t1 or t2 according to
+// the adaptive target p.
+func (c *Cache) RemoveOldest() {
+	c.removeOldest(false)
+}
+
+// inB2 表示即将插入的键是否命中了 b2
+func (c *Cache) removeOldest(inB2 bool) {
+	if q := c.victim(inB2); q != nil {
+		c.evict(q, q.Back(), lru.EvictCapacity)
+	}
+}
+
+// victim 返回下一个被淘汰的节点所在的链表
+func (c *Cache) victim(inB2 bool) *queue.Queue {
+	if c.t1.Len() > 0 && (c.t1.Bytes() > c.p || (c.t1.Bytes() == c.p && inB2) || c.t2.Len() == 0) {
+		return c.t1
+	} else if c.t2.Len() > 0 {
+		return c.t2
+	}
+	return nil
+}
+
+// Contains reports whether key is cached in t1 or t2, without moving it.
+// ghost 中的 key 不算作已缓存
+func (c *Cache) Contains(key string) bool {
+	_, ok1 := c.t1.Lookup(key)
+	_, ok2 := c.t2.Lookup(key)
+	return ok1 || ok2
+}
+
+// Victim returns the key RemoveOldest would evict next.
+func (c *Cache) Victim() (key string, ok bool) {
+	if q := c.victim(false); q != nil {
+		return q.Back().Value.(*queue.Entry).Key, true
+	}
+	return "", false
+}
+
+// trim 保证常驻数据不超过 maxBytes，ghost 链表也不超过 maxBytes
+func (c *Cache) trim() {
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.t1.Len()+c.t2.Len() > 0 && c.t1.Bytes()+c.t2.Bytes() > c.maxBytes {
+		c.removeOldest(false)
+	}
+	for c.b1.Len() > 0 && c.b1.Bytes() > c.maxBytes-c.p {
+		c.b1.RemoveOldest()
+	}
+	for c.b2.Len() > 0 && c.b2.Bytes() > c.p {
+		c.b2.RemoveOldest()
+	}
+}
+
+// evict 将常驻节点移出 q，容量淘汰的节点会记录到对应的 ghost 链表
+func (c *Cache) evict(q *queue.Queue, ele *list.Element, reason lru.EvictReason) {
+	e := q.Remove(ele)
+	if reason == lru.EvictCapacity {
+		ghost := &queue.Entry{Key: e.Key, Size: e.Size}
+		if q == c.t1 {
+			c.b1.PushFront(ghost)
+		} else {
+			c.b2.PushFront(ghost)
+		}
+	}
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.Key, e.Value, reason)
+	}
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.b1.Lookup(key); ok {
+		c.b1.Remove(ele)
+	}
+	if ele, ok := c.b2.Lookup(key); ok {
+		c.b2.Remove(ele)
+	}
+	if ele, ok := c.t1.Lookup(key); ok {
+		c.evict(c.t1, ele, lru.EvictRemoved)
+		return true
+	}
+	if ele, ok := c.t2.Lookup(key); ok {
+		c.evict(c.t2, ele, lru.EvictRemoved)
+		return true
+	}
+	return false
+}
+
+// RemoveExpired removes all expired items and returns how many were removed.
+func (c *Cache) RemoveExpired() int {
+	now := c.now()
+	n := 0
+	for _, q := range []*queue.Queue{c.t1, c.t2} {
+		for ele := q.Back(); ele != nil; {
+			prev := ele.Prev()
+			if ele.Value.(*queue.Entry).Expired(now) {
+				c.evict(q, ele, lru.EvictExpired)
+				n++
+			}
+			ele = prev
+		}
+	}
+	return n
+}
+
+// Len the number of cache entries
+func (c *Cache) Len() int {
+	return c.t1.Len() + c.t2.Len()
+}
+
+// Bytes returns the number of bytes used by keys and values.
+func (c *Cache) Bytes() int64 {
+	return c.t1.Bytes() + c.t2.Bytes()
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
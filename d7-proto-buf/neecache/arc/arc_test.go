@@ -0,0 +1,113 @@
+package arc
+
+import (
+	"fmt"
+	"neecache/lru"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestCache_Get(t *testing.T) {
+	c := New(int64(0), nil)
+	c.Add("key1", String("1234"))
+	if v, ok := c.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := c.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestRemoveOldest(t *testing.T) {
+	k1, k2, k3 := "key1", "key2", "key3"
+	v1, v2, v3 := "value1", "value2", "value3"
+	size := len(k1 + k2 + v1 + v2)
+	c := New(int64(size), nil)
+	c.Add(k1, String(v1))
+	c.Add(k2, String(v2))
+	c.Add(k3, String(v3))
+
+	if _, ok := c.Get("key1"); ok || c.Len() != 2 {
+		t.Fatalf("RemoveOldest key1 failed")
+	}
+}
+
+func TestOnEvicted(t *testing.T) {
+	keys := make([]string, 0)
+	callback := func(key string, value lru.Value, reason lru.EvictReason) {
+		keys = append(keys, key)
+	}
+	c := New(int64(10), callback)
+	c.Add("key1", String("123456"))
+	c.Add("k2", String("k2"))
+	c.Add("k3", String("k3"))
+	c.Add("k4", String("k4"))
+
+	expect := []string{"key1", "k2"}
+	if !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Call OnEvicted failed, expect keys equals to %s, got %s", expect, keys)
+	}
+	if c.Bytes() > 10 {
+		t.Fatalf("now: %d, max: %d", c.Bytes(), 10)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	now := time.Now()
+	reasons := make(map[string]lru.EvictReason)
+	c := New(int64(0), func(key string, value lru.Value, reason lru.EvictReason) {
+		reasons[key] = reason
+	})
+	c.now = func() time.Time { return now }
+	c.AddWithTTL("k1", String("v1"), time.Second)
+	c.AddWithTTL("k2", String("v2"), time.Minute)
+	c.Add("k3", String("v3"))
+	c.Add("k4", String("v4"))
+
+	now = now.Add(2 * time.Second)
+	if _, ok := c.Get("k1"); ok {
+		t.Fatalf("lazy expire k1 failed")
+	}
+	now = now.Add(time.Minute)
+	if n := c.RemoveExpired(); n != 1 || c.Len() != 2 {
+		t.Fatalf("RemoveExpired removed %d, left %d", n, c.Len())
+	}
+	if !c.Remove("k4") || c.Remove("k4") {
+		t.Fatalf("Remove k4 failed")
+	}
+	if _, ok := c.Get("k3"); !ok || c.Bytes() != int64(len("k3")+len("v3")) {
+		t.Fatalf("k3 without ttl should never expire")
+	}
+
+	expect := map[string]lru.EvictReason{"k1": lru.EvictExpired, "k2": lru.EvictExpired, "k4": lru.EvictRemoved}
+	if !reflect.DeepEqual(expect, reasons) {
+		t.Fatalf("Call OnEvicted with reasons %v, expect %v", reasons, expect)
+	}
+}
+
+func TestScanResistant(t *testing.T) {
+	c := New(int64(len("hot0value")*20), nil)
+	// 访问两次的热点数据
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("hot%d", i)
+		c.Add(key, String("value"))
+		c.Get(key)
+	}
+	// 一次性的大范围扫描
+	for i := 0; i < 100; i++ {
+		c.Add(fmt.Sprintf("s%03d", i), String("value"))
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, ok := c.Get(fmt.Sprintf("hot%d", i)); !ok {
+			t.Fatalf("hot%d should survive the scan", i)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package neecache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"neecache/neecachepb"
+	"neecache/singleflight"
+	"net/http"
+	"sync"
+)
+
+// A Result is the value or the error of one key of GetMulti.
+type Result struct {
+	Value ByteView
+	Err   error
+}
+
+// GetMulti returns the values of keys. Keys missing from the caches are
+// grouped by the peer owning them, and fetched with one request per peer,
+// while keys owned by this peer are loaded concurrently.
+// 每个 key 的结果与错误单独返回，一个 key 失败不影响其他 key
+func (g *Group) GetMulti(keys []string) map[string]Result {
+	return g.GetMultiContext(context.Background(), keys)
+}
+
+// GetMultiContext is like GetMulti, ctx is passed to the peers and the getter.
+func (g *Group) GetMultiContext(ctx context.Context, keys []string) map[string]Result {
+	return g.getMulti(ctx, keys, false)
+}
+
+// getMulti 实现 GetMultiContext，local 为 true 时未命中的 key 都在本地加载，不再转发给其他节点
+func (g *Group) getMulti(ctx context.Context, keys []string, local bool) map[string]Result {
+	b := &batch{results: make(map[string]Result, len(keys))}
+	// 需要加载的 key，值为开启 stale-if-error 后保留的过期数据
+	misses := make(map[string]*entry)
+	var locals []string
+	byPeer := make(map[PeerGetter][]string)
+	for _, key := range keys {
+		if key == "" {
+			b.results[key] = Result{Err: fmt.Errorf("key is required")}
+			continue
+		}
+		if _, ok := b.results[key]; ok {
+			continue
+		}
+		if _, ok := misses[key]; ok {
+			continue
+		}
+		value, e, hit, err := g.lookup(key)
+		if hit {
+			b.results[key] = Result{Value: value, Err: err}
+			continue
+		}
+		misses[key] = e
+		if g.peers != nil && !local {
+			if peer, ok := g.peers.PickPeer(key); ok {
+				byPeer[peer] = append(byPeer[peer], key)
+				continue
+			}
+		}
+		locals = append(locals, key)
+	}
+
+	var wg sync.WaitGroup
+	for peer, peerKeys := range byPeer {
+		wg.Add(1)
+		go func(peer PeerGetter, keys []string) {
+			defer wg.Done()
+			g.getMultiFromPeer(ctx, b, peer, keys)
+		}(peer, peerKeys)
+	}
+	g.loadMultiLocally(ctx, b, locals)
+	wg.Wait()
+
+	for key, e := range misses {
+		res := b.results[key]
+		res.Value, res.Err = g.staleOnError(e, res.Value, res.Err)
+		b.results[key] = res
+	}
+	return b.results
+}
+
+// batch 收集 GetMulti 中并发加载的结果
+type batch struct {
+	mu      sync.Mutex
+	results map[string]Result
+}
+
+func (b *batch) set(key string, value ByteView, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.results[key] = Result{Value: value, Err: err}
+}
+
+// defaultLoadConcurrency 默认最多同时调用 getter 的次数
+const defaultLoadConcurrency = 16
+
+// SetLoadConcurrency limits to n the keys of one GetMulti loaded concurrently
+// by the getter, so that a large batch does not flood the source. A
+// non-positive n means defaultLoadConcurrency. It does not apply to a
+// BatchGetter, which loads all keys at once.
+// It should be called before the group serves any request.
+func (g *Group) SetLoadConcurrency(n int) {
+	if n <= 0 {
+		n = defaultLoadConcurrency
+	}
+	g.loadConcurrency = n
+}
+
+// loadMultiLocally 使用最多 loadConcurrency 个协程从本地数据源加载 keys，等待全部完成后返回，
+// getter 实现了 BatchGetter 时一次加载所有 keys
+func (g *Group) loadMultiLocally(ctx context.Context, b *batch, keys []string) {
+	if g.batchGetter != nil && len(keys) > 1 {
+		g.loadBatchLocally(ctx, b, keys)
+		return
+	}
+	g.forEach(keys, func(key string) {
+		value, err := g.loadLocally(ctx, key)
+		b.set(key, value, err)
+	})
+}
+
+// forEach 使用最多 loadConcurrency 个协程对每个 key 调用 fn，全部完成后返回
+func (g *Group) forEach(keys []string, fn func(key string)) {
+	workers := g.loadConcurrency
+	if workers > len(keys) {
+		workers = len(keys)
+	}
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range queue {
+				fn(key)
+			}
+		}()
+	}
+	for _, key := range keys {
+		queue <- key
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// loadBatchLocally 通过 singleflight 对每个 key 去重，其余的 key 一次交给 BatchGetter 加载
+func (g *Group) loadBatchLocally(ctx context.Context, b *batch, keys []string) {
+	results := g.loader.DoMulti(ctx, keys, func(ctx context.Context, keys []string) map[string]singleflight.Result {
+		res := make(map[string]singleflight.Result, len(keys))
+		values, err := g.batchGetter.GetMulti(keys)
+		for _, key := range keys {
+			if err != nil {
+				g.Stats.LocalLoadErrs.Add(1)
+				res[key] = singleflight.Result{Err: err}
+				continue
+			}
+			g.Stats.LocalLoads.Add(1)
+			v, ok := values[key]
+			if !ok {
+				g.populateNegativeCache(key)
+				res[key] = singleflight.Result{Err: ErrNotFound}
+				continue
+			}
+			value := g.newView(v)
+			g.populateCache(key, value)
+			res[key] = singleflight.Result{Val: value}
+		}
+		return res
+	})
+	for key, r := range results {
+		if r.Shared {
+			g.Stats.DedupedLoads.Add(1)
+		}
+		if r.Err != nil {
+			b.set(key, ByteView{}, r.Err)
+			continue
+		}
+		b.set(key, r.Val.(ByteView), nil)
+	}
+}
+
+// getMultiFromPeer 一次请求获取 peer 负责的所有 keys，请求失败时按 fallbackPolicy 处理，
+// 与 load 一样，peer 确认不存在的 key 不再回退
+func (g *Group) getMultiFromPeer(ctx context.Context, b *batch, peer PeerGetter, keys []string) {
+	req := &neecachepb.BatchRequest{
+		Group: g.name,
+		Keys:  keys,
+	}
+	res := &neecachepb.BatchResponse{}
+	if err := peer.GetMulti(ctx, req, res); err != nil {
+		g.Stats.PeerErrors.Add(1)
+		log.Println("[NeeCache] Failed to get multi from peer", err)
+		errs := make(map[string]error, len(keys))
+		for _, key := range keys {
+			errs[key] = err
+		}
+		g.fallbackMulti(ctx, b, peer, keys, errs)
+		return
+	}
+	var failed []string
+	errs := make(map[string]error)
+	for _, key := range keys {
+		kr, ok := res.GetResults()[key]
+		switch {
+		case !ok:
+			// 响应中缺少的 key 同样按 fallbackPolicy 处理
+			failed = append(failed, key)
+			errs[key] = &RemoteError{StatusCode: http.StatusOK, Message: "missing from response"}
+		case kr.GetNotFound():
+			g.Stats.PeerLoads.Add(1)
+			g.populateNegativeCache(key)
+			b.set(key, ByteView{}, ErrNotFound)
+		case kr.GetError() != "":
+			g.Stats.PeerErrors.Add(1)
+			log.Println("[NeeCache] Failed to get from peer", kr.GetError())
+			failed = append(failed, key)
+			errs[key] = &RemoteError{StatusCode: http.StatusOK, Code: kr.GetCode(), Message: kr.GetError()}
+		default:
+			value, err := viewFromPeer(kr.GetValue(), kr.GetEncoding(), kr.GetRawLength())
+			if err != nil {
+				g.Stats.PeerErrors.Add(1)
+				log.Println("[NeeCache] Failed to get from peer", err)
+				failed = append(failed, key)
+				errs[key] = err
+				continue
+			}
+			g.Stats.PeerLoads.Add(1)
+			g.populateHotCache(key, value)
+			b.set(key, value, nil)
+		}
+	}
+	g.fallbackMulti(ctx, b, peer, failed, errs)
+}
+
+// fallbackMulti 与 fallback 相同，处理 peer 未能返回的 keys，errs 记录每个 key 的错误。
+// 需要在本地加载的 key 一起交给 loadMultiLocally，请求 replica 的 key 同样最多 loadConcurrency 个并发，
+// 一个失败节点的整批 key 不会同时压到数据源上
+func (g *Group) fallbackMulti(ctx context.Context, b *batch, peer PeerGetter, keys []string, errs map[string]error) {
+	var local, replicaKeys []string
+	replicas := make(map[string]PeerGetter)
+	for _, key := range keys {
+		err := errs[key]
+		if !shouldFallback(ctx, err) {
+			b.set(key, ByteView{}, err)
+			continue
+		}
+		switch g.fallbackPolicy {
+		case FallbackFailFast:
+			b.set(key, ByteView{}, err)
+			continue
+		case FallbackServeStale:
+			if value, ok := g.staleValue(key); ok {
+				g.Stats.StaleHits.Add(1)
+				b.set(key, value, nil)
+				continue
+			}
+		case FallbackNextReplica:
+			if replica, ok := g.pickReplica(key, peer); ok {
+				replicas[key] = replica
+				replicaKeys = append(replicaKeys, key)
+				continue
+			}
+		}
+		g.countFallbackLoad(peer)
+		local = append(local, key)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		g.forEach(replicaKeys, func(key string) {
+			value, err := g.dedup(ctx, key, func(ctx context.Context) (ByteView, error) {
+				return g.getFromReplica(ctx, replicas[key], key)
+			})
+			b.set(key, value, err)
+		})
+	}()
+	g.loadMultiLocally(ctx, b, local)
+	wg.Wait()
+}
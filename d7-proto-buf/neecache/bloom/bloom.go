@@ -0,0 +1,326 @@
+package bloom
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+)
+
+// Filter is a Bloom filter, safe for concurrent use.
+// 每个键对应 k 个比特位，全部为 1 时认为键可能存在，任意一位为 0 时键一定不存在，
+// 因此只会误判存在（false positive），不会漏判
+type Filter struct {
+	mu    sync.RWMutex
+	m     uint64 // 比特位的个数
+	k     uint64 // 哈希函数的个数
+	bits  []uint64
+	count uint64 // 添加过的键的个数，重复添加的键会被重复计数
+}
+
+// New creates a filter sized for n keys with a false positive rate of about fp.
+func New(n uint64, fp float64) *Filter {
+	m, k := EstimateParameters(n, fp)
+	return NewWithParams(m, k)
+}
+
+// NewWithParams creates a filter of m bits using k hash functions.
+func NewWithParams(m, k uint64) *Filter {
+	if m < 1 {
+		m = 1
+	}
+	if k < 1 {
+		k = 1
+	}
+	return &Filter{m: m, k: k, bits: make([]uint64, words(m))}
+}
+
+// words 返回 m 个比特位需要的 uint64 个数，m 接近 2^64 时不会溢出
+func words(m uint64) uint64 {
+	n := m / 64
+	if m%64 != 0 {
+		n++
+	}
+	return n
+}
+
+// EstimateParameters returns the number of bits m and of hash functions k
+// for n keys with a false positive rate of fp.
+// m = -n·ln(fp)/(ln2)², k = m/n·ln2
+func EstimateParameters(n uint64, fp float64) (m, k uint64) {
+	if n < 1 {
+		n = 1
+	}
+	if fp <= 0 || fp >= 1 {
+		fp = 0.01
+	}
+	m = uint64(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	k = uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return m, k
+}
+
+// Add adds key to the filter.
+func (f *Filter) Add(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.add(key)
+}
+
+// AddAll adds all keys to the filter, e.g. to bulk load the keys of the source.
+func (f *Filter) AddAll(keys []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, key := range keys {
+		f.add(key)
+	}
+}
+
+func (f *Filter) add(key string) {
+	h1, h2 := hash(key)
+	for i := uint64(0); i < f.k; i++ {
+		idx := location(h1, h2, i, f.m)
+		f.bits[idx/64] |= 1 << (idx % 64)
+	}
+	f.count++
+}
+
+// MayContain reports whether key may have been added to the filter.
+// 返回 false 时键一定没有被添加过
+func (f *Filter) MayContain(key string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.mayContain(key)
+}
+
+func (f *Filter) mayContain(key string) bool {
+	h1, h2 := hash(key)
+	for i := uint64(0); i < f.k; i++ {
+		idx := location(h1, h2, i, f.m)
+		if f.bits[idx/64]&(1<<(idx%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Count returns the number of keys added to the filter.
+func (f *Filter) Count() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.count
+}
+
+// Cap returns the number of bits m and of hash functions k of the filter.
+func (f *Filter) Cap() (m, k uint64) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.m, f.k
+}
+
+const (
+	filterMagic   = "NBF1"
+	countingMagic = "NBC1"
+	scalableMagic = "NBS1"
+)
+
+// 读取文件时接受的参数上限，文件损坏时返回错误而不是分配过多的内存或在查询时 panic
+const (
+	// maxBits 比特位的个数，Filter 占用 2 GiB，CountingFilter 占用 16 GiB
+	maxBits = 1 << 34
+	// maxHashes 哈希函数的个数，误判率为 2^-k 时约需要 k 个
+	maxHashes = 256
+	// maxStages ScalableFilter 子过滤器的个数，容量每次翻倍，64 个之后溢出
+	maxStages = 64
+	// readChunk 分块读取的元素个数，内存随实际读到的数据增长，而不是按头部声明的大小一次分配
+	readChunk = 1 << 16
+)
+
+// checkParams 检查从文件读取的比特位个数 m 与哈希函数个数 k
+func checkParams(m, k uint64) error {
+	if m == 0 || m > maxBits || k == 0 || k > maxHashes {
+		return fmt.Errorf("bloom: invalid filter parameters m=%d, k=%d", m, k)
+	}
+	return nil
+}
+
+// readWords 分块读取 n 个 uint64
+func readWords(r io.Reader, n uint64) ([]uint64, error) {
+	var words []uint64
+	for uint64(len(words)) < n {
+		size := n - uint64(len(words))
+		if size > readChunk {
+			size = readChunk
+		}
+		chunk := make([]uint64, size)
+		if err := binary.Read(r, binary.LittleEndian, chunk); err != nil {
+			return nil, err
+		}
+		words = append(words, chunk...)
+	}
+	return words, nil
+}
+
+// readBytes 分块读取 n 个字节
+func readBytes(r io.Reader, n uint64) ([]byte, error) {
+	var buf []byte
+	for uint64(len(buf)) < n {
+		size := n - uint64(len(buf))
+		if size > readChunk {
+			size = readChunk
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, err
+		}
+		buf = append(buf, chunk...)
+	}
+	return buf, nil
+}
+
+// WriteTo writes the filter to w, it can be read back with ReadFrom.
+func (f *Filter) WriteTo(w io.Writer) (int64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	cw := &countWriter{w: w}
+	if _, err := io.WriteString(cw, filterMagic); err != nil {
+		return cw.n, err
+	}
+	err := f.writeBody(cw)
+	return cw.n, err
+}
+
+func (f *Filter) writeBody(w io.Writer) error {
+	if err := binary.Write(w, binary.LittleEndian, [3]uint64{f.m, f.k, f.count}); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, f.bits)
+}
+
+// ReadFrom replaces the filter with one written by WriteTo.
+func (f *Filter) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countReader{r: r}
+	if err := readMagic(cr, filterMagic); err != nil {
+		return cr.n, err
+	}
+	g, err := readFilterBody(cr)
+	if err != nil {
+		return cr.n, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.m, f.k, f.bits, f.count = g.m, g.k, g.bits, g.count
+	return cr.n, nil
+}
+
+func readFilterBody(r io.Reader) (*Filter, error) {
+	var hdr [3]uint64
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if err := checkParams(hdr[0], hdr[1]); err != nil {
+		return nil, err
+	}
+	bits, err := readWords(r, words(hdr[0]))
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{m: hdr[0], k: hdr[1], bits: bits, count: hdr[2]}, nil
+}
+
+// Save writes f to the file at path, replacing the file atomically.
+// 先写入临时文件再重命名，避免进程中途退出留下不完整的文件
+func Save(path string, f io.WriterTo) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	if _, err = f.WriteTo(w); err == nil {
+		err = w.Flush()
+	}
+	if err2 := file.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load reads f from the file at path written by Save.
+func Load(path string, f io.ReaderFrom) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = f.ReadFrom(bufio.NewReader(file))
+	return err
+}
+
+func readMagic(r io.Reader, magic string) error {
+	buf := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+	if string(buf) != magic {
+		return fmt.Errorf("bloom: unexpected header %q, want %q", buf, magic)
+	}
+	return nil
+}
+
+// hash 使用 64 位 FNV-1a 哈希，再经过两次不同的 fmix64 混合，得到双重哈希的两个基础哈希值。
+// FNV 对只有末尾几个字符不同的键分布较差，不混合时误判率明显高于预期
+func hash(key string) (h1, h2 uint64) {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return fmix64(h), fmix64(h^0x9e3779b97f4a7c15) | 1
+}
+
+// fmix64 是 MurmurHash3 的 64 位终结混合函数
+func fmix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// location 第 i 个哈希函数的下标：(h1 + i·h2) mod m（Kirsch-Mitzenmacher 优化）
+func location(h1, h2, i, m uint64) uint64 {
+	return (h1 + i*h2) % m
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,168 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+type filter interface {
+	Add(key string)
+	AddAll(keys []string)
+	MayContain(key string) bool
+	io.WriterTo
+	io.ReaderFrom
+}
+
+func keys(prefix string, n int) []string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = prefix + strconv.Itoa(i)
+	}
+	return list
+}
+
+// falsePositiveRate 统计从未添加过的键被误判为存在的比例
+func falsePositiveRate(f filter, n int) float64 {
+	fp := 0
+	for _, key := range keys("absent", n) {
+		if f.MayContain(key) {
+			fp++
+		}
+	}
+	return float64(fp) / float64(n)
+}
+
+func TestFilter(t *testing.T) {
+	filters := map[string]filter{
+		"bloom":    New(10000, 0.01),
+		"counting": NewCounting(10000, 0.01),
+		"scalable": NewScalable(10000, 0.01),
+	}
+	for name, f := range filters {
+		f.AddAll(keys("key", 10000))
+		for _, key := range keys("key", 10000) {
+			if !f.MayContain(key) {
+				t.Fatalf("%s: added key %s should be found", name, key)
+			}
+		}
+		if rate := falsePositiveRate(f, 10000); rate > 0.02 {
+			t.Fatalf("%s: false positive rate %.4f is too high", name, rate)
+		}
+	}
+}
+
+func TestCountingRemove(t *testing.T) {
+	f := NewCounting(1000, 0.01)
+	f.AddAll(keys("key", 1000))
+	for _, key := range keys("key", 500) {
+		if !f.Remove(key) {
+			t.Fatalf("remove %s failed", key)
+		}
+	}
+	if f.Count() != 500 {
+		t.Fatalf("expected 500 keys left, got %d", f.Count())
+	}
+	for _, key := range keys("key", 1000)[500:] {
+		if !f.MayContain(key) {
+			t.Fatalf("key %s should not be removed with the others", key)
+		}
+	}
+	removed := 0
+	for _, key := range keys("key", 500) {
+		if !f.MayContain(key) {
+			removed++
+		}
+	}
+	if removed < 490 {
+		t.Fatalf("expected removed keys to be absent, only %d of 500 are", removed)
+	}
+}
+
+func TestScalableGrow(t *testing.T) {
+	f := NewScalable(100, 0.01)
+	f.AddAll(keys("key", 10000))
+	if f.Stages() < 2 {
+		t.Fatalf("filter should grow beyond its initial capacity")
+	}
+	if f.Count() > 10000 {
+		t.Fatalf("expected at most 10000 keys, got %d", f.Count())
+	}
+	for _, key := range keys("key", 10000) {
+		if !f.MayContain(key) {
+			t.Fatalf("added key %s should be found", key)
+		}
+	}
+	// 总误判率不超过 fp/(1-r) = 0.02
+	if rate := falsePositiveRate(f, 10000); rate > 0.02 {
+		t.Fatalf("false positive rate %.4f is too high", rate)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	cases := map[string][2]filter{
+		"bloom":    {New(1000, 0.01), &Filter{}},
+		"counting": {NewCounting(1000, 0.01), &CountingFilter{}},
+		"scalable": {NewScalable(100, 0.01), &ScalableFilter{}},
+	}
+	for name, c := range cases {
+		saved, loaded := c[0], c[1]
+		saved.AddAll(keys("key", 1000))
+		path := filepath.Join(dir, name)
+		if err := Save(path, saved); err != nil {
+			t.Fatalf("%s: save failed: %v", name, err)
+		}
+		if err := Load(path, loaded); err != nil {
+			t.Fatalf("%s: load failed: %v", name, err)
+		}
+		for _, key := range keys("key", 1000) {
+			if !loaded.MayContain(key) {
+				t.Fatalf("%s: loaded filter should contain %s", name, key)
+			}
+		}
+		for _, key := range keys("absent", 1000) {
+			if loaded.MayContain(key) != saved.MayContain(key) {
+				t.Fatalf("%s: loaded filter differs from the saved one for %s", name, key)
+			}
+		}
+	}
+	if err := Load(filepath.Join(dir, "bloom"), &CountingFilter{}); err == nil {
+		t.Fatalf("loading a filter of another kind should fail")
+	}
+}
+
+// header 构造只有魔数与头部的文件内容
+func header(magic string, hdr ...uint64) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	binary.Write(&buf, binary.LittleEndian, hdr)
+	return buf.Bytes()
+}
+
+func TestReadCorrupt(t *testing.T) {
+	fp := math.Float64bits(0.01)
+	cases := map[string]struct {
+		f    filter
+		data []byte
+	}{
+		"bits overflow":      {&Filter{}, header(filterMagic, math.MaxUint64, 7, 0)},
+		"too many hashes":    {&Filter{}, header(filterMagic, 64, 1<<40, 0)},
+		"truncated bits":     {&Filter{}, header(filterMagic, maxBits, 7, 0)},
+		"counting too big":   {&CountingFilter{}, header(countingMagic, 1<<60, 7, 0)},
+		"counting truncated": {&CountingFilter{}, header(countingMagic, maxBits, 7, 0)},
+		"too many stages":    {&ScalableFilter{}, header(scalableMagic, 100, fp, 1<<60)},
+		"invalid fp":         {&ScalableFilter{}, header(scalableMagic, 100, math.Float64bits(math.NaN()), 1)},
+		"corrupt stage":      {&ScalableFilter{}, header(scalableMagic, 100, fp, 1, 0, 7, 0)},
+	}
+	for name, c := range cases {
+		// 损坏的文件返回错误，而不是 panic 或按头部分配内存
+		if _, err := c.f.ReadFrom(bytes.NewReader(c.data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
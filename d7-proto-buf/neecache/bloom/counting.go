@@ -0,0 +1,137 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// maxCounter 计数器饱和后不再增减，避免删除导致其他键被漏判
+const maxCounter = 255
+
+// CountingFilter is a Bloom filter with a counter instead of a bit per
+// location, so that keys can be removed. It is safe for concurrent use.
+// 占用的内存是 Filter 的 8 倍
+type CountingFilter struct {
+	mu       sync.RWMutex
+	m        uint64
+	k        uint64
+	counters []uint8
+	count    uint64
+}
+
+// NewCounting creates a counting filter sized for n keys with a false
+// positive rate of about fp.
+func NewCounting(n uint64, fp float64) *CountingFilter {
+	m, k := EstimateParameters(n, fp)
+	return &CountingFilter{m: m, k: k, counters: make([]uint8, m)}
+}
+
+// Add adds key to the filter.
+func (f *CountingFilter) Add(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.add(key)
+}
+
+// AddAll adds all keys to the filter.
+func (f *CountingFilter) AddAll(keys []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, key := range keys {
+		f.add(key)
+	}
+}
+
+func (f *CountingFilter) add(key string) {
+	h1, h2 := hash(key)
+	for i := uint64(0); i < f.k; i++ {
+		if idx := location(h1, h2, i, f.m); f.counters[idx] < maxCounter {
+			f.counters[idx]++
+		}
+	}
+	f.count++
+}
+
+// Remove removes key added before and reports whether it may have been in the
+// filter. Removing a key that was never added can cause false negatives.
+// 只有确实添加过的键才应当被删除
+func (f *CountingFilter) Remove(key string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.mayContain(key) {
+		return false
+	}
+	h1, h2 := hash(key)
+	for i := uint64(0); i < f.k; i++ {
+		if idx := location(h1, h2, i, f.m); f.counters[idx] < maxCounter {
+			f.counters[idx]--
+		}
+	}
+	if f.count > 0 {
+		f.count--
+	}
+	return true
+}
+
+// MayContain reports whether key may be in the filter.
+func (f *CountingFilter) MayContain(key string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.mayContain(key)
+}
+
+func (f *CountingFilter) mayContain(key string) bool {
+	h1, h2 := hash(key)
+	for i := uint64(0); i < f.k; i++ {
+		if f.counters[location(h1, h2, i, f.m)] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Count returns the number of keys added and not removed.
+func (f *CountingFilter) Count() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.count
+}
+
+// WriteTo writes the filter to w, it can be read back with ReadFrom.
+func (f *CountingFilter) WriteTo(w io.Writer) (int64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	cw := &countWriter{w: w}
+	if _, err := io.WriteString(cw, countingMagic); err != nil {
+		return cw.n, err
+	}
+	if err := binary.Write(cw, binary.LittleEndian, [3]uint64{f.m, f.k, f.count}); err != nil {
+		return cw.n, err
+	}
+	_, err := cw.Write(f.counters)
+	return cw.n, err
+}
+
+// ReadFrom replaces the filter with one written by WriteTo.
+func (f *CountingFilter) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countReader{r: r}
+	if err := readMagic(cr, countingMagic); err != nil {
+		return cr.n, err
+	}
+	var hdr [3]uint64
+	if err := binary.Read(cr, binary.LittleEndian, &hdr); err != nil {
+		return cr.n, err
+	}
+	if err := checkParams(hdr[0], hdr[1]); err != nil {
+		return cr.n, err
+	}
+	counters, err := readBytes(cr, hdr[0])
+	if err != nil {
+		return cr.n, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.m, f.k, f.count, f.counters = hdr[0], hdr[1], hdr[2], counters
+	return cr.n, nil
+}
@@ -0,0 +1,162 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+)
+
+const (
+	// growthFactor 每个新的子过滤器的容量是上一个的倍数
+	growthFactor = 2
+	// tighteningRatio 每个新的子过滤器的误判率是上一个的倍数，总误判率不超过 fp/(1-r)
+	tighteningRatio = 0.5
+)
+
+// ScalableFilter is a Bloom filter that grows when the number of keys is not
+// known in advance. It is safe for concurrent use.
+// 当前子过滤器添加的键达到容量后，追加一个容量更大、误判率更低的子过滤器，
+// 查询时任意一个子过滤器命中即认为可能存在
+type ScalableFilter struct {
+	mu     sync.RWMutex
+	n      uint64  // 第一个子过滤器的容量
+	fp     float64 // 第一个子过滤器的误判率
+	stages []*Filter
+}
+
+// NewScalable creates a filter with an initial capacity of n keys and a
+// false positive rate of about fp.
+func NewScalable(n uint64, fp float64) *ScalableFilter {
+	if n < 1 {
+		n = 1
+	}
+	if fp <= 0 || fp >= 1 {
+		fp = 0.01
+	}
+	s := &ScalableFilter{n: n, fp: fp}
+	s.grow()
+	return s
+}
+
+// stageParams 返回第 i 个子过滤器的容量与误判率
+func (s *ScalableFilter) stageParams(i int) (n uint64, fp float64) {
+	return s.n * uint64(math.Pow(growthFactor, float64(i))), s.fp * math.Pow(tighteningRatio, float64(i))
+}
+
+func (s *ScalableFilter) grow() {
+	s.stages = append(s.stages, New(s.stageParams(len(s.stages))))
+}
+
+// Add adds key to the filter.
+func (s *ScalableFilter) Add(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(key)
+}
+
+// AddAll adds all keys to the filter.
+func (s *ScalableFilter) AddAll(keys []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		s.add(key)
+	}
+}
+
+func (s *ScalableFilter) add(key string) {
+	// 已存在的键不再计入容量
+	if s.mayContain(key) {
+		return
+	}
+	last := s.stages[len(s.stages)-1]
+	if n, _ := s.stageParams(len(s.stages) - 1); last.count >= n {
+		s.grow()
+		last = s.stages[len(s.stages)-1]
+	}
+	last.add(key)
+}
+
+// MayContain reports whether key may have been added to the filter.
+func (s *ScalableFilter) MayContain(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.mayContain(key)
+}
+
+func (s *ScalableFilter) mayContain(key string) bool {
+	for _, f := range s.stages {
+		if f.mayContain(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Count returns the number of distinct keys added to the filter,
+// keys mistaken for added ones are not counted.
+func (s *ScalableFilter) Count() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var n uint64
+	for _, f := range s.stages {
+		n += f.count
+	}
+	return n
+}
+
+// Stages returns the number of filters the scalable filter consists of.
+func (s *ScalableFilter) Stages() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.stages)
+}
+
+// WriteTo writes the filter to w, it can be read back with ReadFrom.
+func (s *ScalableFilter) WriteTo(w io.Writer) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cw := &countWriter{w: w}
+	if _, err := io.WriteString(cw, scalableMagic); err != nil {
+		return cw.n, err
+	}
+	hdr := [3]uint64{s.n, math.Float64bits(s.fp), uint64(len(s.stages))}
+	if err := binary.Write(cw, binary.LittleEndian, hdr); err != nil {
+		return cw.n, err
+	}
+	for _, f := range s.stages {
+		if err := f.writeBody(cw); err != nil {
+			return cw.n, err
+		}
+	}
+	return cw.n, nil
+}
+
+// ReadFrom replaces the filter with one written by WriteTo.
+func (s *ScalableFilter) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countReader{r: r}
+	if err := readMagic(cr, scalableMagic); err != nil {
+		return cr.n, err
+	}
+	var hdr [3]uint64
+	if err := binary.Read(cr, binary.LittleEndian, &hdr); err != nil {
+		return cr.n, err
+	}
+	fp := math.Float64frombits(hdr[1])
+	if hdr[0] == 0 || !(fp > 0 && fp < 1) || hdr[2] == 0 || hdr[2] > maxStages {
+		return cr.n, fmt.Errorf("bloom: invalid scalable filter parameters n=%d, fp=%v, stages=%d", hdr[0], fp, hdr[2])
+	}
+	stages := make([]*Filter, hdr[2])
+	for i := range stages {
+		f, err := readFilterBody(cr)
+		if err != nil {
+			return cr.n, err
+		}
+		stages[i] = f
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.n, s.fp, s.stages = hdr[0], fp, stages
+	return cr.n, nil
+}
@@ -1,23 +1,77 @@
 package neecache
 
+import (
+	"fmt"
+	"log"
+)
+
 // A ByteView holds an immutable view of bytes. ReadOnly
+// 开启压缩时 b 保存压缩后的数据，读取时才解压
 type ByteView struct {
 	b []byte
+	c Compressor // 非 nil 表示 b 由 c 压缩
+	n int        // 解压后的长度，仅在 c 非 nil 时有效
 }
 
 // Len returns the view`s length
 func (v ByteView) Len() int {
+	if v.c != nil {
+		return v.n
+	}
 	return len(v.b)
 }
 
 // ByteSlice returns a copy of the data as a byte slice.
+// 压缩的值损坏时返回 nil，需要区分时使用 Sink 读取
 func (v ByteView) ByteSlice() []byte {
-	return cloneBytes(v.b)
+	b, _ := v.bytes()
+	if v.c != nil {
+		return b
+	}
+	return cloneBytes(b)
 }
 
 // String returns the data as a string, making a copy if necessary.
 func (v ByteView) String() string {
-	return string(v.b)
+	b, _ := v.bytes()
+	return string(b)
+}
+
+// Copy copies b into dest and returns the number of bytes copied.
+func (v ByteView) Copy(dest []byte) int {
+	b, _ := v.bytes()
+	return copy(dest, b)
+}
+
+// bytes 返回只读的数据，未压缩时不复制，调用方不能修改
+func (v ByteView) bytes() ([]byte, error) {
+	if v.c != nil {
+		return v.decompress()
+	}
+	return v.b, nil
+}
+
+// size 返回实际占用的字节数，即压缩后的长度
+func (v ByteView) size() int {
+	return len(v.b)
+}
+
+// encoded 返回存储的数据与压缩算法的名称，用于原样发送给远程节点
+func (v ByteView) encoded() ([]byte, string) {
+	if v.c != nil {
+		return v.b, v.c.Name()
+	}
+	return v.b, ""
+}
+
+// decompress 解压数据，解压失败或长度与 n 不一致说明数据已损坏
+func (v ByteView) decompress() ([]byte, error) {
+	b, err := decompressN(v.c, v.b, v.n)
+	if err != nil {
+		log.Println("[NeeCache] Failed to decompress value:", err)
+		return nil, fmt.Errorf("decompressing %s value: %v", v.c.Name(), err)
+	}
+	return b, nil
 }
 
 func cloneBytes(b []byte) []byte {
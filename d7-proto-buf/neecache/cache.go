@@ -2,36 +2,363 @@ package neecache
 
 import (
 	"neecache/lru"
+	"neecache/tinylfu"
 	"sync"
+	"time"
+)
+
+const (
+	// defaultSweepInterval 后台清理过期缓存的默认间隔
+	defaultSweepInterval = time.Minute
+	// windowRatio 启用准入过滤时，窗口 LRU 占总内存的比例（与 Caffeine 一致）
+	windowRatio = 0.01
+	// bytesPerCounter 启用准入过滤时，每多少字节的容量分配一个频次计数器
+	bytesPerCounter = 32
 )
 
 type cache struct {
 	mu         sync.Mutex
-	lru        *lru.Cache
+	store      Policy // 按 policy 延迟创建
+	policy     EvictionPolicy
 	cacheBytes int64
+	// ttl is the default time to live of entries, zero means never expire.
+	ttl time.Duration
+	// stale 过期后数据继续保留的时间，期间只在加载失败时使用
+	stale         time.Duration
+	sweepInterval time.Duration // 后台清理间隔，零值使用 defaultSweepInterval
+	stopSweep     chan struct{} // 非 nil 表示后台清理协程正在运行
+	// onEvict 数据因内存不足或过期被淘汰时调用，主动删除的不调用
+	onEvict func(key string, value ByteView)
+
+	// W-TinyLFU 准入过滤：新数据先进入窗口 LRU，被窗口淘汰后，
+	// 只有比主缓存将淘汰的数据更热，才能进入主缓存
+	admission bool
+	mainBytes int64      // 主缓存的容量
+	window    *lru.Cache // 准入窗口，仅在 admission 为 true 时创建
+	filter    *tinylfu.TinyLFU
+
+	// 统计信息，由 mu 保护
+	gets, hits, evictions int64
+}
+
+// CacheStats are returned by stats accessors on Group.
+type CacheStats struct {
+	Bytes     int64
+	Items     int64
+	Gets      int64
+	Hits      int64
+	Evictions int64 // 因内存不足或过期被淘汰的数量
+}
+
+// CacheType represents a type of cache.
+type CacheType int
+
+const (
+	// MainCache is the cache for items that this peer is the owner for.
+	MainCache CacheType = iota + 1
+	// HotCache is the cache for items that seem popular
+	// enough to replicate to this node, even though it's not the owner.
+	HotCache
+	// NegativeCache is the cache for keys the getter reported as not found.
+	NegativeCache
+)
+
+// entry is a cached value with the time it was added and the time it expires.
+// 窗口中的数据进入主缓存时保留原有的过期时间
+type entry struct {
+	ByteView
+	added  time.Time
+	expire time.Time // 零值表示永不过期
+}
+
+// Len returns the bytes the entry takes in the cache, i.e. the compressed size
+// of the value, so that cacheBytes limits the memory actually used.
+func (e entry) Len() int {
+	return e.ByteView.size()
+}
+
+// expired reports whether the entry is past its ttl and only kept as a stale copy.
+func (e entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+// refreshDue reports whether the entry has lived more than fraction of its ttl.
+func (e entry) refreshDue(now time.Time, fraction float64) bool {
+	if e.expire.IsZero() {
+		return false
+	}
+	ttl := e.expire.Sub(e.added)
+	return now.Sub(e.added) >= time.Duration(float64(ttl)*fraction)
+}
+
+// evictAt 返回淘汰策略删除数据的时间，即过期时间加上 stale
+// c.mu must be held.
+func (c *cache) evictAt(e entry) time.Time {
+	if e.expire.IsZero() {
+		return e.expire
+	}
+	return e.expire.Add(c.stale)
 }
 
 func (c *cache) add(key string, value ByteView) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	// Lazy Initialization	// 延迟实例化
-	// 一个对象的延迟初始化意味着该对象的创建将会延迟至第一次使用该对象时。主要用于提高性能，并减少程序内存要求。
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+	c.lazyInit()
+	e := entry{ByteView: value, added: time.Now()}
+	if c.ttl > 0 {
+		e.expire = e.added.Add(c.ttl)
 	}
-	c.lru.Add(key, value)
+	if c.window == nil {
+		c.store.AddWithExpire(key, e, c.evictAt(e))
+		return
+	}
+	// 已在主缓存中的键原地更新，保留淘汰策略记录的频次与所在的队列，无需再经过准入
+	if c.store.Contains(key) {
+		c.store.AddWithExpire(key, e, c.evictAt(e))
+		return
+	}
+	c.window.AddWithExpire(key, e, c.evictAt(e))
 }
 
+// Lazy Initialization	// 延迟实例化
+// 一个对象的延迟初始化意味着该对象的创建将会延迟至第一次使用该对象时。主要用于提高性能，并减少程序内存要求。
+// c.mu must be held.
+func (c *cache) lazyInit() {
+	if c.store == nil {
+		c.mainBytes = c.cacheBytes
+		// 不限制内存时不存在淘汰，准入过滤没有意义
+		if c.admission && c.cacheBytes > 0 {
+			windowBytes := int64(float64(c.cacheBytes) * windowRatio)
+			if windowBytes < 1 {
+				windowBytes = 1
+			}
+			c.mainBytes -= windowBytes
+			c.window = lru.New(windowBytes, c.onWindowEvicted)
+			c.filter = tinylfu.New(int(c.cacheBytes / bytesPerCounter))
+		}
+		c.store = newPolicy(c.policy, c.mainBytes, c.onEvicted)
+	}
+	if c.ttl > 0 && c.stopSweep == nil {
+		c.startSweeper()
+	}
+}
+
+// onEvicted 统计被淘汰的数据，主动删除的不计入
+// c.mu must be held.
+func (c *cache) onEvicted(key string, value lru.Value, reason lru.EvictReason) {
+	if reason != lru.EvictRemoved {
+		c.evictions++
+		if c.onEvict != nil {
+			c.onEvict(key, value.(entry).ByteView)
+		}
+	}
+}
+
+// onWindowEvicted 窗口淘汰的数据作为候选者，决定是否进入主缓存
+// c.mu must be held.
+func (c *cache) onWindowEvicted(key string, value lru.Value, reason lru.EvictReason) {
+	if reason != lru.EvictCapacity {
+		c.onEvicted(key, value, reason)
+		return
+	}
+	e := value.(entry)
+	// 主缓存尚有空间时直接进入，否则与主缓存将淘汰的数据比较访问频次
+	if c.store.Bytes()+int64(len(key)+e.Len()) > c.mainBytes {
+		if victim, ok := c.store.Victim(); ok && !c.filter.Admit(key, victim) {
+			c.onEvicted(key, e, lru.EvictCapacity)
+			return
+		}
+	}
+	c.store.AddWithExpire(key, e, c.evictAt(e))
+}
+
+// get returns the value of key if it is cached and not expired.
 func (c *cache) get(key string) (value ByteView, ok bool) {
+	e, ok := c.getEntry(key)
+	if !ok || e.expired(time.Now()) {
+		return ByteView{}, false
+	}
+	return e.ByteView, true
+}
+
+// getEntry returns the entry of key, which may be expired if stale entries are
+// kept. Only entries that are not expired count as hits.
+func (c *cache) getEntry(key string) (e entry, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gets++
+	if c.store == nil {
+		return
+	}
+
+	var v interface{}
+	if c.filter != nil {
+		c.filter.Increment(key)
+		v, ok = c.window.Get(key)
+	}
+	if !ok {
+		v, ok = c.store.Get(key)
+	}
+	if !ok {
+		return
+	}
+	e = v.(entry)
+	if !e.expired(time.Now()) {
+		c.hits++
+	}
+	return e, true
+}
+
+// remove removes key from the cache and reports whether it was cached.
+func (c *cache) remove(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.store == nil {
+		return false
+	}
+	removed := c.store.Remove(key)
+	if c.window != nil && c.window.Remove(key) {
+		removed = true
+	}
+	return removed
+}
+
+// bytes returns the number of bytes used by cached keys and values.
+func (c *cache) bytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytesLocked()
+}
+
+func (c *cache) bytesLocked() int64 {
+	if c.store == nil {
+		return 0
+	}
+	n := c.store.Bytes()
+	if c.window != nil {
+		n += c.window.Bytes()
+	}
+	return n
+}
+
+// removeOldest evicts the entry chosen by the eviction policy.
+func (c *cache) removeOldest() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
+	if c.store == nil {
 		return
 	}
+	if c.window != nil && c.store.Len() == 0 {
+		c.window.RemoveOldest()
+		return
+	}
+	c.store.RemoveOldest()
+}
+
+// CacheStats returns a snapshot of the statistics of the cache.
+func (c *cache) CacheStats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := CacheStats{
+		Bytes:     c.bytesLocked(),
+		Gets:      c.gets,
+		Hits:      c.hits,
+		Evictions: c.evictions,
+	}
+	if c.store != nil {
+		stats.Items = int64(c.store.Len())
+		if c.window != nil {
+			stats.Items += int64(c.window.Len())
+		}
+	}
+	return stats
+}
+
+// setStale keeps entries for stale after they expire, values already cached
+// are kept for the previous duration.
+func (c *cache) setStale(stale time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stale = stale
+}
 
-	if v, ok := c.lru.Get(key); ok {
-		byteView, isCan := v.(ByteView)
-		return byteView, isCan
+func (c *cache) setTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+	if c.store != nil && c.ttl > 0 && c.stopSweep == nil {
+		c.startSweeper()
+	}
+}
+
+// resize drops all cached values and sets a new byte budget.
+func (c *cache) resize(cacheBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cacheBytes = cacheBytes
+	c.store, c.window, c.filter = nil, nil, nil
+}
+
+// setAdmission enables or disables the W-TinyLFU admission filter.
+// 已缓存的数据会被清空，并在下次写入时按新的配置重新创建
+func (c *cache) setAdmission(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.admission = enabled
+	c.store, c.window, c.filter = nil, nil, nil
+}
+
+// admissionStats returns how many candidates the admission filter admitted and rejected.
+func (c *cache) admissionStats() (admitted, rejected int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.filter == nil {
+		return
+	}
+	return c.filter.Admitted(), c.filter.Rejected()
+}
+
+// startSweeper 启动后台协程，定期清理过期但未被访问到的缓存
+// c.mu must be held.
+func (c *cache) startSweeper() {
+	interval := c.sweepInterval
+	if interval <= 0 {
+		interval = defaultSweepInterval
+	}
+	stop := make(chan struct{})
+	c.stopSweep = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.removeExpired()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (c *cache) removeExpired() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.store == nil {
+		return
+	}
+	c.store.RemoveExpired()
+	if c.window != nil {
+		c.window.RemoveExpired()
+	}
+}
+
+// close stops the background sweeper, if any.
+func (c *cache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopSweep != nil {
+		close(c.stopSweep)
+		c.stopSweep = nil
 	}
-	return
 }
@@ -0,0 +1,104 @@
+package neecache
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestShardedCache(t *testing.T) {
+	s := newShardedCache(4, 4<<10, PolicyLRU)
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		s.add(key, ByteView{b: []byte(key)})
+	}
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		if v, ok := s.get(key); !ok || v.String() != key {
+			t.Fatalf("get %s from sharded cache failed", key)
+		}
+	}
+	for _, c := range s.all() {
+		if c.cacheBytes != 1<<10 {
+			t.Fatalf("each shard should hold 1/4 of the cache bytes, got %d", c.cacheBytes)
+		}
+		if c.store == nil || c.store.Len() == 0 {
+			t.Fatalf("keys should be spread over all shards")
+		}
+	}
+
+	s.reshard(8)
+	if n := len(s.all()); n != 8 {
+		t.Fatalf("reshard to 8 shards, got %d", n)
+	}
+	if _, ok := s.get("1"); ok {
+		t.Fatalf("values should be dropped after reshard")
+	}
+}
+
+// BenchmarkCacheParallel 比较不同分片数下的并发吞吐，
+// 使用 go test -bench=CacheParallel -cpu=1,2,4,8 观察随核数的扩展情况
+func BenchmarkCacheParallel(b *testing.B) {
+	const keys = 1 << 12
+	names := make([]string, keys)
+	for i := range names {
+		names[i] = "key" + strconv.Itoa(i)
+	}
+	value := ByteView{b: make([]byte, 64)}
+	for _, n := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("shards-%d", n), func(b *testing.B) {
+			s := newShardedCache(n, 1<<20, PolicyLRU)
+			for _, key := range names {
+				s.add(key, value)
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					key := names[i%keys]
+					// 九成读，一成写
+					if i%10 == 0 {
+						s.add(key, value)
+					} else {
+						s.get(key)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	c := &cache{cacheBytes: 19}
+	c.add("k1", ByteView{b: []byte("12345678")})
+	c.add("k2", ByteView{b: []byte("12345678")})
+	c.get("k1")
+	c.get("k2")
+
+	expect := CacheStats{Bytes: 10, Items: 1, Gets: 2, Hits: 1, Evictions: 1}
+	if stats := c.CacheStats(); stats != expect {
+		t.Fatalf("cache stats %+v, expect %+v", stats, expect)
+	}
+}
+
+func TestCacheAdmissionUpdate(t *testing.T) {
+	c := &cache{cacheBytes: 1 << 10, policy: PolicyLFU, admission: true}
+	c.add("x", ByteView{b: []byte("x")})
+	// 直接放入主缓存，a 的访问频次高于 b
+	c.store.AddWithExpire("a", entry{ByteView: ByteView{b: []byte("1")}}, time.Time{})
+	c.store.AddWithExpire("b", entry{ByteView: ByteView{b: []byte("1")}}, time.Time{})
+	for i := 0; i < 3; i++ {
+		c.store.Get("a")
+	}
+	c.store.Get("b")
+
+	c.add("a", ByteView{b: []byte("2")})
+	if victim, _ := c.store.Victim(); victim != "b" {
+		t.Fatalf("updating a should keep its frequency, victim is %s", victim)
+	}
+	if v, ok := c.get("a"); !ok || v.String() != "2" {
+		t.Fatalf("a should be updated in the main cache")
+	}
+}
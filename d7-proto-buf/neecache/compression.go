@@ -0,0 +1,225 @@
+package neecache
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// A Compressor compresses the values cached by a group.
+// It must be safe for concurrent use.
+type Compressor interface {
+	// Name identifies the compressor between peers, e.g. "gzip".
+	Name() string
+	Compress(b []byte) ([]byte, error)
+	Decompress(b []byte) ([]byte, error)
+}
+
+var (
+	// Gzip compresses values with gzip at the default level.
+	Gzip Compressor = &gzipCompressor{}
+	// Flate compresses values with DEFLATE at flate.BestSpeed, it is faster
+	// than Gzip at the cost of a lower ratio.
+	Flate Compressor = &flateCompressor{}
+)
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[string]Compressor{
+		Gzip.Name():  Gzip,
+		Flate.Name(): Flate,
+	}
+)
+
+// RegisterCompressor makes c known by its name, so that values compressed by c
+// on a peer can be decompressed by this one. Gzip and Flate are registered.
+func RegisterCompressor(c Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	compressors[c.Name()] = c
+}
+
+func compressorByName(name string) (Compressor, error) {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	c, ok := compressors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression %q", name)
+	}
+	return c, nil
+}
+
+// SetCompression makes the group compress values of at least threshold bytes
+// with c before caching them. Values are sent to peers compressed, and are
+// only decompressed when read, cacheBytes accounts for the compressed size.
+// A nil c disables compression, which is the default.
+// It should be called before the group serves any request.
+// 压缩后没有变小的值按原样保存
+func (g *Group) SetCompression(c Compressor, threshold int) {
+	g.compressor = c
+	g.compressThreshold = threshold
+}
+
+// newView 复制 b 作为缓存的值，达到阈值时压缩
+func (g *Group) newView(b []byte) ByteView {
+	if g.compressor == nil || len(b) < g.compressThreshold {
+		return ByteView{b: cloneBytes(b)}
+	}
+	compressed, err := g.compressor.Compress(b)
+	if err != nil || len(compressed) >= len(b) {
+		return ByteView{b: cloneBytes(b)}
+	}
+	return ByteView{b: compressed, c: g.compressor, n: len(b)}
+}
+
+// viewFromPeer 使用远程节点返回的数据构造 ByteView，压缩过的数据保持压缩，读取时才解压。
+// 这里不解压校验，以免每个值多解压一次：gzip 只检查头部与尾部记录的原始长度，
+// 其他算法的损坏在读取时发现，解压最多读取 n+1 个字节，长度与 n 不一致时返回错误
+func viewFromPeer(b []byte, encoding string, n int64) (ByteView, error) {
+	if encoding == "" {
+		return ByteView{b: b}, nil
+	}
+	c, err := compressorByName(encoding)
+	if err != nil {
+		return ByteView{}, err
+	}
+	if n < 0 || int64(int(n)) != n {
+		return ByteView{}, fmt.Errorf("corrupt %s value from peer: invalid raw length %d", encoding, n)
+	}
+	if v, ok := c.(sizeVerifier); ok {
+		if err := v.verifySize(b, int(n)); err != nil {
+			return ByteView{}, fmt.Errorf("corrupt %s value from peer: %v", encoding, err)
+		}
+	}
+	return ByteView{b: b, c: c, n: int(n)}, nil
+}
+
+// sizeVerifier 由可以不解压就检查原始长度的压缩算法实现
+type sizeVerifier interface {
+	verifySize(b []byte, n int) error
+}
+
+// readerDecompressor 由内置的压缩算法实现，解压时可以限制读取的长度
+type readerDecompressor interface {
+	reader(b []byte) (io.ReadCloser, error)
+}
+
+// decompressN 解压 b，解压后的长度必须为 n。
+// 内置的算法最多读取 n+1 个字节，损坏的数据不会分配过多的内存
+func decompressN(c Compressor, b []byte, n int) ([]byte, error) {
+	var raw []byte
+	var err error
+	if rd, ok := c.(readerDecompressor); ok {
+		var r io.ReadCloser
+		if r, err = rd.reader(b); err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		raw, err = ioutil.ReadAll(io.LimitReader(r, int64(n)+1))
+	} else {
+		raw, err = c.Decompress(b)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != n {
+		return nil, fmt.Errorf("%d bytes, expected %d", len(raw), n)
+	}
+	return raw, nil
+}
+
+type gzipCompressor struct {
+	writers sync.Pool
+}
+
+func (c *gzipCompressor) Name() string {
+	return "gzip"
+}
+
+func (c *gzipCompressor) Compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, ok := c.writers.Get().(*gzip.Writer)
+	if ok {
+		w.Reset(&buf)
+	} else {
+		w = gzip.NewWriter(&buf)
+	}
+	defer c.writers.Put(w)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *gzipCompressor) Decompress(b []byte) ([]byte, error) {
+	r, err := c.reader(b)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func (c *gzipCompressor) reader(b []byte) (io.ReadCloser, error) {
+	return gzip.NewReader(bytes.NewReader(b))
+}
+
+// verifySize 检查 gzip 的魔数与尾部的 ISIZE（原始长度模 2^32），不需要解压
+func (c *gzipCompressor) verifySize(b []byte, n int) error {
+	// 10 字节的头部，至少 2 字节的数据，8 字节的 CRC32 与 ISIZE
+	if len(b) < 20 || b[0] != 0x1f || b[1] != 0x8b {
+		return errors.New("invalid gzip header")
+	}
+	if size := binary.LittleEndian.Uint32(b[len(b)-4:]); size != uint32(n) {
+		return fmt.Errorf("%d bytes, expected %d", size, n)
+	}
+	return nil
+}
+
+type flateCompressor struct {
+	writers sync.Pool
+}
+
+func (c *flateCompressor) Name() string {
+	return "flate"
+}
+
+func (c *flateCompressor) Compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, ok := c.writers.Get().(*flate.Writer)
+	if ok {
+		w.Reset(&buf)
+	} else {
+		var err error
+		if w, err = flate.NewWriter(&buf, flate.BestSpeed); err != nil {
+			return nil, err
+		}
+	}
+	defer c.writers.Put(w)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *flateCompressor) Decompress(b []byte) ([]byte, error) {
+	r, _ := c.reader(b)
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func (c *flateCompressor) reader(b []byte) (io.ReadCloser, error) {
+	return flate.NewReader(bytes.NewReader(b)), nil
+}
@@ -0,0 +1,139 @@
+package neecache
+
+import (
+	"bytes"
+	"context"
+	"neecache/neecachepb"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressors(t *testing.T) {
+	value := []byte(strings.Repeat(`{"name":"Tom","score":630}`, 100))
+	for _, c := range []Compressor{Gzip, Flate} {
+		compressed, err := c.Compress(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(compressed) >= len(value) {
+			t.Fatalf("%s: %d bytes not compressed", c.Name(), len(compressed))
+		}
+		b, err := c.Decompress(compressed)
+		if err != nil || !bytes.Equal(b, value) {
+			t.Fatalf("%s: round trip failed: %v", c.Name(), err)
+		}
+		if got, err := compressorByName(c.Name()); err != nil || got != c {
+			t.Fatalf("%s should be registered", c.Name())
+		}
+	}
+	if _, err := compressorByName("zstd"); err == nil {
+		t.Fatalf("unknown compressor should fail")
+	}
+}
+
+func TestGroupCompression(t *testing.T) {
+	r := NewRegistry()
+	large := strings.Repeat(`{"name":"Tom","score":630}`, 100)
+	nee, err := r.NewGroup("compressed", GetterFunc(func(key string) ([]byte, error) {
+		if key == "small" {
+			return []byte("630"), nil
+		}
+		return []byte(large), nil
+	}), WithCompression(Flate, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	view, err := nee.Get("large")
+	if err != nil || view.String() != large || view.Len() != len(large) {
+		t.Fatalf("large value should round trip")
+	}
+	if view.c != Flate || view.size() >= len(large) {
+		t.Fatalf("large value should be stored compressed")
+	}
+	// 缓存按压缩后的大小计算内存
+	if bytes := nee.CacheStats(MainCache).Bytes; bytes >= int64(len(large)) {
+		t.Fatalf("expected compressed size to be accounted, got %d bytes", bytes)
+	}
+
+	view, err = nee.Get("small")
+	if err != nil || view.c != nil || view.String() != "630" {
+		t.Fatalf("value under the threshold should not be compressed")
+	}
+}
+
+func TestCompressionPeer(t *testing.T) {
+	r := NewRegistry()
+	large := strings.Repeat("Tom:630;", 100)
+	r.NewGroup("compressed", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(large), nil
+	}), WithCompression(Gzip, 0))
+	server := httptest.NewServer(NewHTTPPoolWithRegistry("server", r))
+	defer server.Close()
+	getter := &httpGetter{baseURL: server.URL + defaultBasePath, latency: newHistogram(defaultBuckets)}
+
+	out := &neecachepb.Response{}
+	in := &neecachepb.Request{Group: "compressed", Key: "Tom"}
+	if err := getter.Get(context.Background(), in, out); err != nil {
+		t.Fatal(err)
+	}
+	if out.GetEncoding() != "gzip" || len(out.GetValue()) >= len(large) {
+		t.Fatalf("value should be transferred compressed")
+	}
+	view, err := viewFromPeer(out.GetValue(), out.GetEncoding(), out.GetRawLength())
+	if err != nil || view.String() != large || view.Len() != len(large) {
+		t.Fatalf("value from peer should be decompressed on read, got %v", err)
+	}
+}
+
+func TestCorruptCompressedValue(t *testing.T) {
+	large := strings.Repeat("Tom:630;", 100)
+	compressed, _ := Gzip.Compress([]byte(large))
+	if _, err := viewFromPeer([]byte("not gzip"), "gzip", int64(len(large))); err == nil {
+		t.Fatalf("undecodable value from peer should be rejected")
+	}
+	if _, err := viewFromPeer(compressed, "gzip", int64(len(large))+1); err == nil {
+		t.Fatalf("raw length mismatch should be rejected")
+	}
+	if _, err := viewFromPeer(compressed[:len(compressed)/2], "gzip", int64(len(large))); err == nil {
+		t.Fatalf("truncated value from peer should be rejected")
+	}
+	// 不能提前检查长度的算法在读取时发现错误，声明的长度过短时不会读完整个值
+	deflated, _ := Flate.Compress([]byte(large))
+	for _, n := range []int64{int64(len(large)) - 1, int64(len(large)) + 1} {
+		view, err := viewFromPeer(deflated, "flate", n)
+		if err != nil {
+			t.Fatalf("flate value should be accepted without decompressing it, got %v", err)
+		}
+		if _, err := view.bytes(); err == nil {
+			t.Fatalf("raw length %d should be rejected on read", n)
+		}
+	}
+
+	// 本节点缓存中损坏的值通过 Sink 读取时返回错误，而不是空值
+	corrupt := ByteView{b: []byte("not gzip"), c: Gzip, n: len(large)}
+	var s string
+	var b []byte
+	sinks := map[string]Sink{
+		"string":     StringSink(&s),
+		"allocating": AllocatingByteSliceSink(&b),
+		"truncating": TruncatingByteSliceSink(&b),
+		"proto":      ProtoSink(&neecachepb.Response{}),
+	}
+	for name, sink := range sinks {
+		if err := sink.SetView(corrupt); err == nil {
+			t.Fatalf("%s sink should fail on a corrupt value", name)
+		}
+	}
+	typed, err := NewTypedGroupIn[string](NewRegistry(), "corrupt", JSONCodec[string]{}, TypedGetterFunc[string](func(_ context.Context, key string) (string, error) {
+		return key, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	typed.Group().populateCache("Tom", corrupt)
+	if _, err := typed.Get(context.Background(), "Tom"); err == nil {
+		t.Fatalf("typed get should fail on a corrupt value")
+	}
+}
@@ -4,57 +4,267 @@ import (
 	"hash/crc32"
 	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 )
 
 // Hash mas bytes ti uint32
 type Hash func(data []byte) uint32
 
 // Map contains all hashed keys
+// 哈希环是不可变的快照，Add 与 Remove 复制后原子地替换，Get 不需要加锁
 type Map struct {
-	hash     Hash           // Hash 化函数
-	replicas int            // 虚拟节点倍数
-	keys     []int          // Sorted，哈希环
-	hashMap  map[int]string // 维护虚拟节点，键是虚拟节点的哈希值，值是真实节点的名称
+	mu       sync.Mutex   // 串行化 Add 与 Remove
+	hash     Hash         // Hash 化函数
+	mix      bool         // 打散虚拟节点的哈希值，由 NewMixed 设置
+	replicas int          // 虚拟节点倍数
+	ring     atomic.Value // *ring，当前的哈希环
 }
 
-// New creates a Map instance
+// ring is an immutable snapshot of the hash.
+type ring struct {
+	keys    []int          // Sorted，哈希环
+	hashMap map[int]string // 维护虚拟节点，键是虚拟节点的哈希值，值是真实节点的名称
+	nodes   map[string]int // 真实节点与其虚拟节点的个数
+}
+
+// New creates a Map instance. A nil fn uses crc32.
 func New(replicas int, fn Hash) *Map {
 	m := &Map{
 		replicas: replicas,
 		hash:     fn,
-		hashMap:  make(map[int]string),
 	}
 
 	if m.hash == nil {
 		m.hash = crc32.ChecksumIEEE
 	}
+	m.ring.Store(&ring{
+		hashMap: make(map[int]string),
+		nodes:   make(map[string]int),
+	})
 	return m
 }
 
-// Add adds some keys to the hash.
+// NewMixed creates a Map using crc32 whose virtual node positions are mixed,
+// so that keys are spread in proportion to the weights given to AddWeighted.
+// The positions differ from those of New, all peers must use the same
+// constructor, switching moves most keys.
+func NewMixed(replicas int) *Map {
+	m := New(replicas, nil)
+	m.mix = true
+	return m
+}
+
+func (m *Map) load() *ring {
+	return m.ring.Load().(*ring)
+}
+
+// Add adds some keys to the hash. Keys already in the hash are ignored.
+// 只计算新节点的虚拟节点，与已排序的哈希环归并，其余节点的位置不变
 func (m *Map) Add(keys ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	nodes := m.load().nodes
+	add := make(map[string]int, len(keys))
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
+		if _, ok := nodes[key]; !ok {
+			add[key] = m.replicas
+		}
+	}
+	m.update(nil, keys, add)
+}
+
+// AddWeighted adds key with weight times the replicas of the hash, so that it
+// owns about weight times the items of a key added by Add. A weight below 1
+// is taken as 1. Adding a key already in the hash changes its weight, only
+// items moving to or from key change their key.
+// 虚拟节点 i 的哈希值与权重无关，调整权重只增减该节点的虚拟节点
+func (m *Map) AddWeighted(key string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	replicas, ok := m.load().nodes[key]
+	if ok && replicas == weight*m.replicas {
+		return
+	}
+	var remove []string
+	if ok {
+		remove = []string{key}
+	}
+	m.update(remove, []string{key}, map[string]int{key: weight * m.replicas})
+}
+
+// Remove removes some keys from the hash, only the items hashed to them move
+// to other keys. Keys not in the hash are ignored.
+func (m *Map) Remove(keys ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.update(keys, nil, nil)
+}
+
+// update 删除 remove 中的节点，再按 order 的顺序加入 add 中的节点及其虚拟节点个数，
+// 然后原子地替换哈希环
+// m.mu must be held.
+func (m *Map) update(remove []string, order []string, add map[string]int) {
+	old := m.load()
+	r := old.clone()
+	removed := make(map[int]bool)
+	for _, key := range remove {
+		replicas, ok := r.nodes[key]
+		if !ok {
+			continue
+		}
+		delete(r.nodes, key)
+		for i := 0; i < replicas; i++ {
+			hash := m.replicaHash(i, key)
+			// 冲突的虚拟节点属于其他节点
+			if r.hashMap[hash] == key {
+				delete(r.hashMap, hash)
+				removed[hash] = true
+			}
+		}
+	}
+	var added []int
+	for _, key := range order {
+		replicas, ok := add[key]
+		if !ok {
+			continue
+		}
+		// order 中重复的节点只加入一次
+		delete(add, key)
+		r.nodes[key] = replicas
+		for i := 0; i < replicas; i++ {
+			hash := m.replicaHash(i, key)
+			// 哈希冲突时保留先加入的节点
+			if _, ok := r.hashMap[hash]; ok {
+				continue
+			}
+			r.hashMap[hash] = key
+			if removed[hash] {
+				// 删除后又加入的虚拟节点仍在 old.keys 中
+				delete(removed, hash)
+				continue
+			}
+			added = append(added, hash)
+		}
+	}
+	if len(removed) == 0 && len(added) == 0 && len(r.nodes) == len(old.nodes) {
+		return
+	}
+	keys := old.keys
+	if len(removed) > 0 {
+		keys = make([]int, 0, len(old.keys)-len(removed))
+		for _, hash := range old.keys {
+			if !removed[hash] {
+				keys = append(keys, hash)
+			}
 		}
 	}
 	// 环上的哈希值排序
-	sort.Ints(m.keys)
+	sort.Ints(added)
+	r.keys = merge(keys, added)
+	m.ring.Store(r)
+}
+
+// replicaHash 返回节点 key 的第 i 个虚拟节点的哈希值。
+// crc32 是线性的，名称等长的两个节点的虚拟节点只相差一个固定的异或值，
+// 各节点在环上的间隔因此互相关联，权重为 1 的节点可能少拿 20% 以上的 key
+func (m *Map) replicaHash(i int, key string) int {
+	hash := m.hash([]byte(strconv.Itoa(i) + key))
+	if m.mix {
+		hash = fmix32(hash)
+	}
+	return int(hash)
+}
+
+// fmix32 is the finalizer of MurmurHash3.
+func fmix32(h uint32) uint32 {
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+// clone copies the maps of r, keys is left to the caller.
+func (r *ring) clone() *ring {
+	c := &ring{
+		hashMap: make(map[int]string, len(r.hashMap)),
+		nodes:   make(map[string]int, len(r.nodes)),
+	}
+	for hash, key := range r.hashMap {
+		c.hashMap[hash] = key
+	}
+	for key, replicas := range r.nodes {
+		c.nodes[key] = replicas
+	}
+	return c
+}
+
+// merge returns the sorted union of the sorted slices a and b.
+func merge(a, b []int) []int {
+	keys := make([]int, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] <= b[j] {
+			keys = append(keys, a[i])
+			i++
+		} else {
+			keys = append(keys, b[j])
+			j++
+		}
+	}
+	keys = append(keys, a[i:]...)
+	return append(keys, b[j:]...)
+}
+
+// Len returns the number of keys in the hash.
+func (m *Map) Len() int {
+	return len(m.load().nodes)
 }
 
 // Get gets the closest item in the hash to the provided key.
-func (m Map) Get(key string) string {
-	if len(m.keys) == 0 {
+func (m *Map) Get(key string) string {
+	r := m.load()
+	if len(r.keys) == 0 {
 		return ""
 	}
 
 	hash := int(m.hash([]byte(key)))
 	// Binary search for appropriate replica.
-	idx := sort.Search(len(m.keys), func(i int) bool {
-		return m.keys[i] >= hash
-	})
+	idx := r.search(hash)
 
-	return m.hashMap[m.keys[idx%len(m.keys)]]
+	return r.hashMap[r.keys[idx%len(r.keys)]]
+}
+
+// GetN returns up to n distinct items following key on the hash, the first
+// one is the item returned by Get.
+// 沿哈希环顺时针查找，跳过同一真实节点的其他虚拟节点
+func (m *Map) GetN(key string, n int) []string {
+	r := m.load()
+	if len(r.keys) == 0 || n <= 0 {
+		return nil
+	}
+	hash := int(m.hash([]byte(key)))
+	idx := r.search(hash)
+	items := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; i < len(r.keys) && len(items) < n; i++ {
+		item := r.hashMap[r.keys[(idx+i)%len(r.keys)]]
+		if !seen[item] {
+			seen[item] = true
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// search 返回第一个不小于 hash 的虚拟节点的下标
+func (r *ring) search(hash int) int {
+	return sort.Search(len(r.keys), func(i int) bool {
+		return r.keys[i] >= hash
+	})
 }
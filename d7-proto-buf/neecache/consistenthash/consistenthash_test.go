@@ -0,0 +1,285 @@
+package consistenthash
+
+import (
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestHashing(t *testing.T) {
+	hash := New(3, func(data []byte) uint32 {
+		i, _ := strconv.Atoi(string(data))
+		return uint32(i)
+	})
+
+	// Given the above hash function, this will give replicas with "hashes":
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+
+	testCases := map[string]string{
+		"2":  "2",
+		"11": "2",
+		"23": "4",
+		"27": "2",
+	}
+
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, should have yield %s", k, v)
+		}
+	}
+
+	// Adds 8, 18, 28
+	hash.Add("8")
+
+	fmt.Println(hash.load().keys)
+	// 27 should now map to 8.
+	testCases["27"] = "8"
+
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, should have yielded %s", k, v)
+		}
+	}
+}
+func TestGetN(t *testing.T) {
+	hash := New(3, func(data []byte) uint32 {
+		i, _ := strconv.Atoi(string(data))
+		return uint32(i)
+	})
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+
+	testCases := map[string][]string{
+		"2":  {"2", "4", "6"},
+		"15": {"6", "2", "4"},
+		"27": {"2", "4", "6"},
+	}
+	for k, v := range testCases {
+		if got := hash.GetN(k, 3); !reflect.DeepEqual(got, v) {
+			t.Errorf("Asking for %s, should have yielded %v, got %v", k, v, got)
+		}
+	}
+	if got := hash.GetN("15", 10); len(got) != 3 {
+		t.Errorf("expected all 3 items, got %v", got)
+	}
+	if got := hash.GetN("15", 1); !reflect.DeepEqual(got, []string{hash.Get("15")}) {
+		t.Errorf("first item should be the one returned by Get, got %v", got)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(data []byte) uint32 {
+		i, _ := strconv.Atoi(string(data))
+		return uint32(i)
+	})
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+	hash.Remove("4", "unknown")
+
+	testCases := map[string]string{
+		"2":  "2",
+		"3":  "6",
+		"23": "6",
+		"27": "2",
+	}
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, should have yielded %s", k, v)
+		}
+	}
+	if hash.Len() != 2 || len(hash.load().keys) != 6 {
+		t.Errorf("expected 2 items with 6 replicas, got %d and %v", hash.Len(), hash.load().keys)
+	}
+
+	hash.Remove("2", "6")
+	if hash.Get("2") != "" || hash.Len() != 0 {
+		t.Errorf("empty hash should yield nothing")
+	}
+}
+
+// moved 返回 before 与 after 中归属节点不同的 key
+func moved(before, after map[string]string) []string {
+	var keys []string
+	for k, v := range before {
+		if after[k] != v {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func owners(hash *Map, n int) map[string]string {
+	m := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		key := "key" + strconv.Itoa(i)
+		m[key] = hash.Get(key)
+	}
+	return m
+}
+
+func TestMembershipChange(t *testing.T) {
+	const nodes, keys = 10, 100000
+	hash := New(100, nil)
+	for i := 0; i < nodes; i++ {
+		hash.Add("http://10.0.0." + strconv.Itoa(i) + ":8001")
+	}
+	before := owners(hash, keys)
+
+	// 加入一个节点，只有约 1/(N+1) 的 key 移动到新节点
+	added := "http://10.0.0.100:8001"
+	hash.Add(added)
+	afterAdd := owners(hash, keys)
+	keysMoved := moved(before, afterAdd)
+	for _, k := range keysMoved {
+		if afterAdd[k] != added {
+			t.Fatalf("%s moved from %s to %s instead of the new node", k, before[k], afterAdd[k])
+		}
+	}
+	if ratio := float64(len(keysMoved)) / keys; ratio < 0.5/(nodes+1) || ratio > 1.5/(nodes+1) {
+		t.Fatalf("expected about 1/%d of keys to move, got %.3f", nodes+1, ratio)
+	}
+
+	// 删除一个节点，只有该节点的 key 移动
+	removed := "http://10.0.0.3:8001"
+	hash.Remove(removed)
+	afterRemove := owners(hash, keys)
+	keysMoved = moved(afterAdd, afterRemove)
+	for _, k := range keysMoved {
+		if afterAdd[k] != removed {
+			t.Fatalf("%s moved from %s which was not removed", k, afterAdd[k])
+		}
+	}
+	if ratio := float64(len(keysMoved)) / keys; ratio < 0.5/(nodes+1) || ratio > 1.5/(nodes+1) {
+		t.Fatalf("expected about 1/%d of keys to move, got %.3f", nodes+1, ratio)
+	}
+
+	// 重新加入后与删除前一致
+	hash.Remove(added)
+	hash.Add(removed)
+	if keysMoved = moved(before, owners(hash, keys)); len(keysMoved) != 0 {
+		t.Fatalf("restoring the members should restore the owners, %d keys moved", len(keysMoved))
+	}
+}
+
+func TestConcurrentGet(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("a", "b", "c")
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// 成员变化期间 a 与 b 始终在环上
+				if owner := hash.Get("key"); owner == "" {
+					t.Error("Get should always find a node")
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		hash.Remove("c")
+		hash.Add("c", "d"+strconv.Itoa(i))
+		hash.Remove("d" + strconv.Itoa(i))
+	}
+	close(done)
+	wg.Wait()
+}
+
+func BenchmarkGet(b *testing.B) {
+	hash := New(50, nil)
+	for i := 0; i < 10; i++ {
+		hash.Add("http://10.0.0." + strconv.Itoa(i) + ":8001")
+	}
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			hash.Get("key" + strconv.Itoa(i))
+			i++
+		}
+	})
+}
+
+func TestAddWeighted(t *testing.T) {
+	const clusters, keys = 20, 20000
+	// 4 GB、8 GB、16 GB 与 32 GB 的节点
+	weights := []int{1, 2, 4, 8}
+	const total = 15
+	// 单个集群的份额受虚拟节点位置的随机性影响，50 个虚拟节点约有 14% 的偏差，
+	// 取多个节点名称不同的集群的平均值检查默认配置下份额与权重成比例
+	shares := make([]float64, len(weights))
+	var hash *Map
+	for c := 0; c < clusters; c++ {
+		hash = NewMixed(50)
+		for i, weight := range weights {
+			hash.AddWeighted(weightedNode(c, i), weight)
+		}
+		counts := make(map[string]int)
+		for _, owner := range owners(hash, keys) {
+			counts[owner]++
+		}
+		for i, weight := range weights {
+			want := float64(keys) * float64(weight) / total
+			shares[i] += float64(counts[weightedNode(c, i)]) / want / clusters
+		}
+	}
+	for i, share := range shares {
+		if share < 0.9 || share > 1.1 {
+			t.Errorf("nodes with weight %d own %.2f times their share of keys", weights[i], share)
+		}
+	}
+
+	// 调整权重只在该节点与其他节点之间移动 key
+	before := owners(hash, keys)
+	node := weightedNode(clusters-1, 0)
+	hash.AddWeighted(node, 4)
+	after := owners(hash, keys)
+	for _, k := range moved(before, after) {
+		if after[k] != node {
+			t.Fatalf("%s moved from %s to %s instead of the reweighted node", k, before[k], after[k])
+		}
+	}
+	hash.AddWeighted(node, 1)
+	if keysMoved := moved(before, owners(hash, keys)); len(keysMoved) != 0 {
+		t.Fatalf("restoring the weight should restore the owners, %d keys moved", len(keysMoved))
+	}
+	if replicas := hash.load().nodes[node]; replicas != 50 {
+		t.Fatalf("expected 50 replicas, got %d", replicas)
+	}
+}
+
+func TestNewPositions(t *testing.T) {
+	// New 的虚拟节点位置与加入权重之前一致，滚动升级时节点之间的 key 不会移动
+	hash := New(50, nil)
+	hash.Add("http://10.0.0.1:8001")
+	for _, h := range hash.load().keys {
+		found := false
+		for i := 0; i < 50; i++ {
+			if h == int(crc32.ChecksumIEEE([]byte(strconv.Itoa(i)+"http://10.0.0.1:8001"))) {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("virtual node %d should be the crc32 of its name", h)
+		}
+	}
+	if mixed := NewMixed(50); mixed.replicaHash(0, "a") == hash.replicaHash(0, "a") {
+		t.Fatalf("NewMixed should mix the positions")
+	}
+}
+
+// weightedNode 返回第 c 个集群的第 i 个节点的名称
+func weightedNode(c, i int) string {
+	return "http://10.0." + strconv.Itoa(100+c) + "." + strconv.Itoa(i+1) + ":8001"
+}
@@ -0,0 +1,102 @@
+package neecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"neecache/neecachepb"
+	"net/http"
+)
+
+// ErrNotFound is returned by a Getter when the key does not exist in the
+// source. Getters may wrap it, Group.Get returns an error matching it with
+// errors.Is, also when the miss was reported by the peer owning the key.
+// 开启负缓存后，返回 ErrNotFound 的 key 会在一段时间内直接返回该错误，不再访问数据源
+var ErrNotFound = errors.New("neecache: not found")
+
+// ErrPeerUnavailable matches the errors of a PeerGetter that could not get an
+// answer from the peer, e.g. the connection was refused or the peer is
+// overloaded. The group loads such keys itself.
+var ErrPeerUnavailable = errors.New("neecache: peer unavailable")
+
+// ErrRemote matches the errors reported by a peer, see RemoteError.
+var ErrRemote = errors.New("neecache: remote error")
+
+// A RemoteError is an error reported by the peer owning a key.
+// 远程节点的数据源出错(SOURCE_ERROR)时不再回退到本地加载
+type RemoteError struct {
+	// StatusCode is the HTTP status of the response.
+	StatusCode int
+	// Code classifies the error, it is UNKNOWN if the peer did not set it.
+	Code    neecachepb.Code
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("neecache: remote error: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Is makes a RemoteError match ErrRemote, and ErrPeerUnavailable if the peer
+// reported it could not load the key or a gateway failed.
+func (e *RemoteError) Is(target error) bool {
+	switch target {
+	case ErrRemote:
+		return true
+	case ErrPeerUnavailable:
+		if e.Code == neecachepb.Code_UNAVAILABLE {
+			return true
+		}
+		switch e.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return e.Code == neecachepb.Code_UNKNOWN
+		}
+	}
+	return false
+}
+
+// unavailableError 包装请求远程节点时的网络错误
+type unavailableError struct {
+	err error
+}
+
+func (e *unavailableError) Error() string {
+	return ErrPeerUnavailable.Error() + ": " + e.err.Error()
+}
+
+func (e *unavailableError) Is(target error) bool {
+	return target == ErrPeerUnavailable
+}
+
+func (e *unavailableError) Unwrap() error {
+	return e.err
+}
+
+// errorCode 返回发送给请求方的错误分类
+func errorCode(err error) neecachepb.Code {
+	var remote *RemoteError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return neecachepb.Code_NOT_FOUND
+	case errors.As(err, &remote) && remote.Code != neecachepb.Code_UNKNOWN:
+		return remote.Code
+	case errors.Is(err, ErrPeerUnavailable),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return neecachepb.Code_UNAVAILABLE
+	default:
+		return neecachepb.Code_SOURCE_ERROR
+	}
+}
+
+// shouldFallback 判断从远程节点获取失败的 key 是否在本地加载：
+// ctx 已结束，或远程节点的数据源出错时直接返回错误，其余错误回退到本地加载
+func shouldFallback(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var remote *RemoteError
+	if errors.As(err, &remote) && remote.Code == neecachepb.Code_SOURCE_ERROR {
+		return false
+	}
+	return true
+}
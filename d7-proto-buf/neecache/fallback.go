@@ -0,0 +1,129 @@
+package neecache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"neecache/neecachepb"
+)
+
+// FallbackPolicy decides how a group loads a key when the peer owning the key
+// fails. It does not apply to the misses reported by the owner, nor when the
+// getter of the owner failed, see RemoteError.
+// 默认在本地加载，一个节点故障时所有其他节点都会访问数据源，可以按需选择其他策略
+type FallbackPolicy int
+
+const (
+	// FallbackLoadLocally loads the key with the getter of this node.
+	FallbackLoadLocally FallbackPolicy = iota
+	// FallbackFailFast returns the error of the peer. A stale value is still
+	// served if SetStaleIfError is used.
+	FallbackFailFast
+	// FallbackNextReplica asks the next owner of the key to load it, the
+	// PeerPicker must implement ReplicaPicker. The key is loaded locally if
+	// this node is the next owner, and the error is returned if the replica fails.
+	FallbackNextReplica
+	// FallbackServeStale serves the expired value kept by SetStaleIfError
+	// and only loads the key locally if there is none.
+	FallbackServeStale
+)
+
+// SetFallbackPolicy sets what the group does when the peer owning a key fails,
+// FallbackLoadLocally by default.
+// It should be called before the group serves any request.
+func (g *Group) SetFallbackPolicy(policy FallbackPolicy) {
+	g.fallbackPolicy = policy
+}
+
+// fallbackLoadCounter is implemented by a PeerGetter counting the keys loaded
+// locally on its behalf.
+type fallbackLoadCounter interface {
+	countFallbackLoad()
+}
+
+// fallback 按 fallbackPolicy 处理 peer 加载 key 失败的情况，err 是 peer 返回的错误
+func (g *Group) fallback(ctx context.Context, key string, peer PeerGetter, err error) (ByteView, error) {
+	if !shouldFallback(ctx, err) {
+		return ByteView{}, err
+	}
+	switch g.fallbackPolicy {
+	case FallbackFailFast:
+		return ByteView{}, err
+	case FallbackServeStale:
+		if value, ok := g.staleValue(key); ok {
+			g.Stats.StaleHits.Add(1)
+			log.Println("[NeeCache] serve stale value after peer failed:", err)
+			return value, nil
+		}
+	case FallbackNextReplica:
+		if replica, ok := g.pickReplica(key, peer); ok {
+			return g.getFromReplica(ctx, replica, key)
+		}
+	}
+	return g.loadOnBehalf(ctx, key, peer)
+}
+
+// pickReplica 返回 peer 失败后 key 的下一个归属节点，ok 为 false 时在本地加载
+func (g *Group) pickReplica(key string, peer PeerGetter) (PeerGetter, bool) {
+	if picker, ok := g.peers.(ReplicaPicker); ok {
+		return picker.PickReplica(key, peer)
+	}
+	return nil, false
+}
+
+// loadOnBehalf 代替失败的 peer 在本地加载 key
+func (g *Group) loadOnBehalf(ctx context.Context, key string, peer PeerGetter) (ByteView, error) {
+	g.countFallbackLoad(peer)
+	return g.loadFromGetter(ctx, key)
+}
+
+func (g *Group) countFallbackLoad(peer PeerGetter) {
+	g.Stats.FallbackLoads.Add(1)
+	if c, ok := peer.(fallbackLoadCounter); ok {
+		c.countFallbackLoad()
+	}
+}
+
+// staleValue 返回 mainCache 或 hotCache 中保留的过期数据
+func (g *Group) staleValue(key string) (ByteView, bool) {
+	if e, ok := g.mainCache.getEntry(key); ok {
+		return e.ByteView, true
+	}
+	if e, ok := g.hotCache.getEntry(key); ok {
+		return e.ByteView, true
+	}
+	return ByteView{}, false
+}
+
+// getFromReplica 请求 replica 代替失败的归属节点加载 key，replica 不再转发该请求
+func (g *Group) getFromReplica(ctx context.Context, replica PeerGetter, key string) (ByteView, error) {
+	req := &neecachepb.Request{
+		Group:   g.name,
+		Key:     key,
+		Replica: true,
+	}
+	value, err := g.fetch(ctx, replica, req)
+	if errors.Is(err, ErrNotFound) {
+		g.Stats.PeerLoads.Add(1)
+		g.populateNegativeCache(key)
+		return ByteView{}, err
+	}
+	if err != nil {
+		g.Stats.PeerErrors.Add(1)
+		log.Println("[NeeCache] Failed to get from replica", err)
+		return ByteView{}, err
+	}
+	g.Stats.PeerLoads.Add(1)
+	g.populateHotCache(key, value)
+	return value, nil
+}
+
+// getReplica 处理 getFromReplica 的请求，未命中时在本地加载
+func (g *Group) getReplica(ctx context.Context, key string) (ByteView, error) {
+	value, stale, hit, err := g.lookup(key)
+	if hit {
+		return value, err
+	}
+	value, err = g.loadLocally(ctx, key)
+	return g.staleOnError(stale, value, err)
+}
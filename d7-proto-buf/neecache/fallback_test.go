@@ -0,0 +1,244 @@
+package neecache
+
+import (
+	"context"
+	"errors"
+	"neecache/neecachepb"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// downPeer 模拟无法连接的节点
+type downPeer struct {
+	fakePeer
+}
+
+func (p *downPeer) Get(_ context.Context, in *neecachepb.Request, out *neecachepb.Response) error {
+	p.gets++
+	return &unavailableError{errors.New("connection refused")}
+}
+
+func (p *downPeer) GetMulti(_ context.Context, in *neecachepb.BatchRequest, out *neecachepb.BatchResponse) error {
+	p.gets++
+	return &unavailableError{errors.New("connection refused")}
+}
+
+// replicaPeer 只接受归属节点失败后代为加载的请求
+type replicaPeer struct {
+	fakePeer
+}
+
+func (p *replicaPeer) Get(ctx context.Context, in *neecachepb.Request, out *neecachepb.Response) error {
+	if !in.GetReplica() {
+		return errors.New("not a replica request")
+	}
+	return p.fakePeer.Get(ctx, in, out)
+}
+
+type replicaPicker struct {
+	owner   PeerGetter
+	replica PeerGetter // 为 nil 时本节点是下一个归属节点
+}
+
+func (p *replicaPicker) PickPeer(key string) (PeerGetter, bool) {
+	return p.owner, true
+}
+
+func (p *replicaPicker) PickReplica(key string, failed PeerGetter) (PeerGetter, bool) {
+	if failed != p.owner || p.replica == nil {
+		return nil, false
+	}
+	return p.replica, true
+}
+
+func TestFallbackPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   FallbackPolicy
+		replica  bool
+		err      error
+		value    string
+		loads    int
+		fallback int64
+	}{
+		{name: "load locally", policy: FallbackLoadLocally, value: "db-Tom", loads: 1, fallback: 1},
+		{name: "fail fast", policy: FallbackFailFast, err: ErrPeerUnavailable},
+		{name: "next replica", policy: FallbackNextReplica, replica: true, value: "peer-Tom"},
+		{name: "next replica is self", policy: FallbackNextReplica, value: "db-Tom", loads: 1, fallback: 1},
+		{name: "serve stale without stale value", policy: FallbackServeStale, value: "db-Tom", loads: 1, fallback: 1},
+	}
+	for _, tt := range tests {
+		loads := 0
+		nee, _ := NewRegistry().NewGroup("fallback", GetterFunc(func(key string) ([]byte, error) {
+			loads++
+			return []byte("db-" + key), nil
+		}), WithFallbackPolicy(tt.policy))
+		owner, replica := &downPeer{}, &replicaPeer{}
+		picker := &replicaPicker{owner: owner}
+		if tt.replica {
+			picker.replica = replica
+		}
+		nee.RegisterPeers(picker)
+
+		view, err := nee.Get("Tom")
+		if tt.err != nil && !errors.Is(err, tt.err) {
+			t.Fatalf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+		if tt.err == nil && (err != nil || view.String() != tt.value) {
+			t.Fatalf("%s: expected %s, got %q, %v", tt.name, tt.value, view.String(), err)
+		}
+		if loads != tt.loads || nee.Stats.FallbackLoads.Get() != tt.fallback {
+			t.Fatalf("%s: expected %d loads and %d fallback loads, got %d and %d",
+				tt.name, tt.loads, tt.fallback, loads, nee.Stats.FallbackLoads.Get())
+		}
+		if tt.replica && replica.gets != 1 {
+			t.Fatalf("%s: replica should be asked once, got %d", tt.name, replica.gets)
+		}
+
+		// GetMulti 使用相同的策略
+		results := nee.GetMulti([]string{"Jack"})
+		if tt.err != nil && !errors.Is(results["Jack"].Err, tt.err) {
+			t.Fatalf("%s: GetMulti expected %v, got %v", tt.name, tt.err, results["Jack"].Err)
+		}
+		if tt.err == nil && results["Jack"].Value.String() != strings.Replace(tt.value, "Tom", "Jack", 1) {
+			t.Fatalf("%s: GetMulti got %q, %v", tt.name, results["Jack"].Value.String(), results["Jack"].Err)
+		}
+	}
+}
+
+func TestFallbackMultiBounded(t *testing.T) {
+	keys := make([]string, 200)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+	for _, policy := range []FallbackPolicy{FallbackServeStale, FallbackNextReplica} {
+		var running, max int32
+		nee, _ := NewRegistry().NewGroupCtx("fallback-multi", GetterCtxFunc(func(_ context.Context, key string) ([]byte, error) {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			return []byte("db-" + key), nil
+		}), WithFallbackPolicy(policy), WithLoadConcurrency(4))
+		// 没有过期数据，下一个归属节点是本节点，所有 key 都在本地加载
+		owner := &downPeer{}
+		nee.RegisterPeers(&replicaPicker{owner: owner})
+		for key, res := range nee.GetMulti(keys) {
+			if res.Err != nil || res.Value.String() != "db-"+key {
+				t.Fatalf("policy %d: get %s failed: %v", policy, key, res.Err)
+			}
+		}
+		if m := atomic.LoadInt32(&max); m > 4 {
+			t.Fatalf("policy %d: expected at most 4 concurrent loads, got %d", policy, m)
+		}
+		if n := nee.Stats.FallbackLoads.Get(); n != int64(len(keys)) {
+			t.Fatalf("policy %d: expected %d fallback loads, got %d", policy, len(keys), n)
+		}
+	}
+
+	// BatchGetter 一次加载失败节点的所有 key
+	batch := &batchDB{}
+	nee, _ := NewRegistry().NewGroup("fallback-batch", batch, WithFallbackPolicy(FallbackServeStale))
+	nee.RegisterPeers(&replicaPicker{owner: &downPeer{}})
+	nee.GetMulti(keys)
+	if batch.gets != 0 || batch.batches != 1 {
+		t.Fatalf("expected 1 batch load, got %d batches and %d gets", batch.batches, batch.gets)
+	}
+}
+
+func TestFallbackServeStale(t *testing.T) {
+	loads := 0
+	nee, _ := NewRegistry().NewGroup("fallback-stale", GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte("db-" + key), nil
+	}), WithTTL(50*time.Millisecond), WithStaleIfError(time.Hour), WithFallbackPolicy(FallbackServeStale))
+	nee.setLocally("Tom", []byte("cached-Tom"))
+	nee.RegisterPeers(&replicaPicker{owner: &downPeer{}})
+	time.Sleep(100 * time.Millisecond)
+
+	if view, err := nee.Get("Tom"); err != nil || view.String() != "cached-Tom" || loads != 0 {
+		t.Fatalf("stale value should be served instead of loading, got %q, %v", view.String(), err)
+	}
+	if nee.Stats.StaleHits.Get() != 1 {
+		t.Fatalf("expected 1 stale hit, got %d", nee.Stats.StaleHits.Get())
+	}
+}
+
+func TestFallbackHTTPPool(t *testing.T) {
+	// replica 节点的 group 把所有 key 路由到已经关闭的归属节点
+	down := httptest.NewServer(nil)
+	down.Close()
+	r := NewRegistry()
+	replicaPool := NewHTTPPoolWithRegistry("replica", r)
+	replicaPool.Set(down.URL)
+	loads := 0
+	r.NewGroup("fallback-pool", GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte("replica-" + key), nil
+	}), WithPeers(replicaPool))
+	replica := httptest.NewServer(replicaPool)
+	defer replica.Close()
+
+	getter := &httpGetter{baseURL: replica.URL + defaultBasePath, latency: newHistogram(defaultBuckets)}
+	out := &neecachepb.Response{}
+	in := &neecachepb.Request{Group: "fallback-pool", Key: "Tom", Replica: true}
+	if err := getter.Get(context.Background(), in, out); err != nil || string(out.GetValue()) != "replica-Tom" {
+		t.Fatalf("replica should load the key itself, got %q, %v", out.GetValue(), err)
+	}
+	if loads != 1 || replicaPool.load().getters[down.URL].fallbackLoads.Get() != 0 {
+		t.Fatalf("replica request should not be forwarded to the owner")
+	}
+
+	// 不带 replica 标记的请求转发给归属节点，失败后在本地加载并记录
+	in.Replica = false
+	if err := getter.Get(context.Background(), in, out); err != nil {
+		t.Fatal(err)
+	}
+	if loads != 1 {
+		t.Fatalf("Tom should be cached by the replica")
+	}
+	in.Key = "Jack"
+	if err := getter.Get(context.Background(), in, out); err != nil || string(out.GetValue()) != "replica-Jack" {
+		t.Fatalf("failed to get Jack: %v", err)
+	}
+	if n := replicaPool.load().getters[down.URL].fallbackLoads.Get(); n != 1 {
+		t.Fatalf("expected 1 load on behalf of %s, got %d", down.URL, n)
+	}
+	rec := httptest.NewRecorder()
+	replicaPool.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if want := `neecache_peer_fallback_loads_total{peer="` + down.URL + `"} 1`; !strings.Contains(rec.Body.String(), want) {
+		t.Fatalf("metrics should contain %s", want)
+	}
+}
+
+func TestPickReplica(t *testing.T) {
+	pool := NewHTTPPool("a")
+	pool.Set("a", "b", "c")
+	for _, key := range []string{"Tom", "Jack", "Sam", "Lily"} {
+		nodes := pool.load().placement.GetN(key, 3)
+		replica, ok := pool.PickReplica(key, pool.load().getters[nodes[0]])
+		if nodes[1] == "a" {
+			if ok {
+				t.Fatalf("%s: this node is the next owner, should not pick a replica", key)
+			}
+			continue
+		}
+		if !ok || replica != pool.load().getters[nodes[1]] {
+			t.Fatalf("%s: expected replica %s", key, nodes[1])
+		}
+		// 有界负载选出的溢出节点失败时同样选择其后的节点
+		spill := spillGetter{pool.load().getters[nodes[0]]}
+		if replica, ok := pool.PickReplica(key, spill); !ok || replica != pool.load().getters[nodes[1]] {
+			t.Fatalf("%s: expected replica %s after a failed spill peer", key, nodes[1])
+		}
+	}
+}
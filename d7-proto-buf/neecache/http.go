@@ -1,40 +1,103 @@
 package neecache
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"google.golang.org/protobuf/proto"
 	"io"
 	"io/ioutil"
 	"log"
+	"math"
 	"neecache/consistenthash"
 	"neecache/neecachepb"
+	"neecache/placement"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	defaultBasePath = "/_neecache/"
 	defaultReplicas = 50
+	// batchPath 批量查找使用 POST 请求 /<basepath>/_batch/<group>，因此 _batch 不能用作 group 的名称
+	batchPath = "_batch"
 )
 
 // HTTPPool implements PeerPicker for a pool of HTTP peers
 type HTTPPool struct {
 	// this peer`s base URL, e.g. "https://example.net:8000"
-	self     string              // 记录自己的地址，包括主机名/IP和端口
-	basePath string              // 通信前缀，默认是"/_neecache/"
-	mu       sync.Mutex          // guards peers and httpGetters
-	peers    *consistenthash.Map // 类型是一致性哈希算法的Map,用来根据具体的key选择节点。
+	self     string       // 记录自己的地址，包括主机名/IP和端口
+	basePath string       // 通信前缀，默认是"/_neecache/"
+	registry *Registry    // 查找远程节点请求的 group
+	mu       sync.Mutex   // 串行化节点的变更
+	peers    atomic.Value // *peerSet，PickPeer 读取时不加锁
+	// 以下字段由 mu 保护
+	placementSet bool // 使用 SetPlacement 设置的算法，而不是默认的哈希环
+	mixed        bool // 默认的哈希环由 consistenthash.NewMixed 创建
+}
+
+// peerSet is a snapshot of the peers of a pool. It is replaced as a whole on
+// every change, only the placement is updated in place, it is lock-free too.
+// 先发布包含新节点的快照再加入 placement，先从 placement 删除再发布不含该节点的快照，
+// 因此在 placement 之后读取的快照总能找到新节点的 getter
+type peerSet struct {
+	placement placement.Placement // 根据具体的key选择节点，默认是一致性哈希算法的Map
 	// 映射远程节点与对应的httpGetter.每一个远程节点对应一个httpGetter，因为httpGetter 与远程节点的地址 baseURL 有关
-	httpGetters map[string]*httpGetter // keyed by e.g. "http://10.0.0.2:8008
+	getters map[string]*httpGetter // keyed by e.g. "http://10.0.0.2:8008
+	weights map[string]int         // 节点的权重
+	// epsilon 大于零时启用有界负载，节点的负载上限为 (1+epsilon) 倍的平均负载
+	epsilon float64
+}
+
+// with returns a copy of s with the given getters and weights.
+func (s *peerSet) with(getters map[string]*httpGetter, weights map[string]int) *peerSet {
+	return &peerSet{placement: s.placement, getters: getters, weights: weights, epsilon: s.epsilon}
 }
 
 // NewHTTPPool initializes an HTTP pool of peers.
 func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
+	return NewHTTPPoolWithRegistry(self, DefaultRegistry)
+}
+
+// NewHTTPPoolWithRegistry initializes an HTTP pool of peers serving the groups of registry.
+func NewHTTPPoolWithRegistry(self string, registry *Registry) *HTTPPool {
+	p := &HTTPPool{
 		self:     self,
 		basePath: defaultBasePath,
+		registry: registry,
+	}
+	p.peers.Store(&peerSet{
+		placement: consistenthash.New(defaultReplicas, nil),
+		getters:   make(map[string]*httpGetter),
+		weights:   make(map[string]int),
+	})
+	return p
+}
+
+func (p *HTTPPool) load() *peerSet {
+	return p.peers.Load().(*peerSet)
+}
+
+// lookup 返回 key 的归属节点与其 getter，快照在 placement 之后读取。
+// 读取期间节点恰好被删除时 getter 不存在，此时重新查找；
+// 快照未变化时 placement 中的节点不属于 pool，当作没有节点
+func (p *HTTPPool) lookup(key string) (s *peerSet, peer string, getter *httpGetter) {
+	for {
+		before := p.load()
+		peer = before.placement.Get(key)
+		s = p.load()
+		if getter, ok := s.getters[peer]; ok || peer == "" {
+			return s, peer, getter
+		}
+		if s == before {
+			return s, "", nil
+		}
 	}
 }
 
@@ -45,11 +108,15 @@ func (p *HTTPPool) Log(format string, v ...interface{}) {
 
 // ServerHTTP handle all http requests
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == defaultMetricsPath {
+		p.MetricsHandler().ServeHTTP(w, r)
+		return
+	}
 	if !strings.HasPrefix(r.URL.Path, p.basePath) {
 		panic("HTTPPool serving unexpected path: " + r.URL.Path)
 	}
 	p.Log("%s %s", r.Method, r.URL.Path)
-	// /<basepath>/<groupname>/<key> required
+	// /<basepath>/<groupname>/<key> or /<basepath>/_batch/<groupname> required
 	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
 	if len(parts) != 2 {
 		http.Error(w, "bad request", http.StatusBadRequest)
@@ -58,28 +125,171 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	groupName := parts[0]
 	key := parts[1]
+	batch := groupName == batchPath
+	if batch {
+		groupName, key = key, ""
+	}
 
-	group := GetGroup(groupName)
+	group := p.registry.GetGroup(groupName)
 	if group == nil {
 		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
 		return
 	}
 
-	view, err := group.Get(key)
+	if batch {
+		if r.Method != http.MethodPost {
+			http.Error(w, "batch get requires POST", http.StatusMethodNotAllowed)
+			return
+		}
+		p.serveGetMulti(w, r, group)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		p.serveSet(w, r, group, key)
+	case http.MethodDelete:
+		p.serveDelete(w, group, key)
+	case http.MethodPost:
+		if key == "" {
+			http.Error(w, "key is required", http.StatusBadRequest)
+			return
+		}
+		p.serveInvalidate(w, r, group, key)
+	default:
+		query := r.URL.Query()
+		p.serveGet(w, r, group, key, query.Get("replica") == "true" || query.Get("spill") == "true")
+	}
+}
+
+// serveGet 使用请求的 context 加载，请求方断开连接或超时后停止加载，
+// local 为 true 时归属节点已失败或负载过高，本节点代为加载，不再转发
+func (p *HTTPPool) serveGet(w http.ResponseWriter, r *http.Request, group *Group, key string, local bool) {
+	group.Stats.ServerRequests.Add(1)
+	get := group.GetContext
+	if local {
+		get = group.getReplica
+	}
+	view, err := get(r.Context(), key)
+	// 不存在的 key 作为正常结果返回，请求方据此返回 ErrNotFound
+	if errors.Is(err, ErrNotFound) {
+		writeProto(w, &neecachepb.Response{NotFound: true, Code: neecachepb.Code_NOT_FOUND})
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		code := errorCode(err)
+		status := http.StatusInternalServerError
+		if code == neecachepb.Code_UNAVAILABLE {
+			status = http.StatusServiceUnavailable
+		}
+		writeProtoStatus(w, status, &neecachepb.Response{Code: code, Error: err.Error()})
 		return
 	}
 
 	// Write the value to the resposne body as a proto message.
-	body, err := proto.Marshal(&neecachepb.Response{
-		Value: view.ByteSlice(),
+	// 压缩过的值原样发送，由请求方读取时解压
+	value, encoding := view.encoded()
+	writeProto(w, &neecachepb.Response{
+		Value:     value,
+		Encoding:  encoding,
+		RawLength: int64(view.Len()),
 	})
+}
+
+// serveSet 本节点是 key 的归属节点，直接写入本地缓存，不再路由到其他节点
+func (p *HTTPPool) serveSet(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	in := &neecachepb.SetRequest{}
+	if err = proto.Unmarshal(data, in); err != nil {
+		http.Error(w, "decoding request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	group.setLocally(key, in.GetValue())
+	writeProto(w, &neecachepb.SetResponse{})
+}
+
+// serveDelete 从本地缓存中删除，不再路由到其他节点
+func (p *HTTPPool) serveDelete(w http.ResponseWriter, group *Group, key string) {
+	writeProto(w, &neecachepb.DeleteResponse{
+		Deleted: group.deleteLocally(key),
+	})
+}
+
+// serveInvalidate 从本地的所有缓存中删除，同一个 id 只生效一次
+func (p *HTTPPool) serveInvalidate(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	in := &neecachepb.InvalidateRequest{}
+	if err = proto.Unmarshal(data, in); err != nil {
+		http.Error(w, "decoding request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeProto(w, &neecachepb.InvalidateResponse{
+		Removed: group.invalidateLocally(in.GetId(), key),
+	})
+}
+
+// serveGetMulti 批量查找请求体中的所有 key，每个 key 的结果单独返回
+func (p *HTTPPool) serveGetMulti(w http.ResponseWriter, r *http.Request, group *Group) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	in := &neecachepb.BatchRequest{}
+	if err = proto.Unmarshal(data, in); err != nil {
+		http.Error(w, "decoding request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	group.Stats.ServerRequests.Add(1)
+	results := group.getMulti(r.Context(), in.GetKeys(), in.GetSpill())
+	out := &neecachepb.BatchResponse{Results: make(map[string]*neecachepb.KeyResult, len(results))}
+	for key, res := range results {
+		kr := &neecachepb.KeyResult{}
+		switch {
+		case errors.Is(res.Err, ErrNotFound):
+			kr.NotFound = true
+			kr.Code = neecachepb.Code_NOT_FOUND
+		case res.Err != nil:
+			kr.Code = errorCode(res.Err)
+			kr.Error = res.Err.Error()
+		default:
+			kr.Value, kr.Encoding = res.Value.encoded()
+			kr.RawLength = int64(res.Value.Len())
+		}
+		out.Results[key] = kr
+	}
+	writeProto(w, out)
+}
+
+// newRemoteError 解析远程节点返回的错误，响应体不是 Response 时使用其文本作为错误信息
+func newRemoteError(status int, body []byte) *RemoteError {
+	out := &neecachepb.Response{}
+	if err := proto.Unmarshal(body, out); err == nil && out.GetCode() != neecachepb.Code_UNKNOWN {
+		return &RemoteError{StatusCode: status, Code: out.GetCode(), Message: out.GetError()}
+	}
+	return &RemoteError{StatusCode: status, Message: strings.TrimSpace(string(body))}
+}
+
+func writeProto(w http.ResponseWriter, m proto.Message) {
+	writeProtoStatus(w, http.StatusOK, m)
+}
+
+// writeProtoStatus 以指定的状态码返回 proto 消息，用于携带错误分类的响应
+func writeProtoStatus(w http.ResponseWriter, status int, m proto.Message) {
+	body, err := proto.Marshal(m)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(status)
 	_, err = w.Write(body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -88,65 +298,376 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 // Set updates the pool`s list if peers.
-// 实例化一致性哈希算法，并且添加了传入的节点
+// 所有节点的权重为 1
 func (p *HTTPPool) Set(peers ...string) {
+	weights := make(map[string]int, len(peers))
+	for _, peer := range peers {
+		weights[peer] = 1
+	}
+	p.SetWeighted(weights)
+}
+
+// SetWeighted updates the pool`s list of peers, a peer with weight w owns about
+// w times the keys of a peer with weight 1, e.g. weights can be the GB of
+// memory given to the cache by each peer. All peers must use the same weights.
+// With the default placement, weights other than 1 switch to a ring created by
+// consistenthash.NewMixed, whose positions differ, so most keys move once;
+// when all weights are 1 the ring of Set is used again.
+// 只从哈希环上删除离开的节点、加入新的节点或调整权重，其余节点负责的 key 与统计数据保持不变
+func (p *HTTPPool) SetWeighted(peers map[string]int) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	p.httpGetters = make(map[string]*httpGetter, len(peers))
-	for _, peer := range peers {
-		// 为每一个节点创建一个HTTP客户端 httpGetter
-		p.httpGetters[peer] = &httpGetter{
-			baseURL: peer + p.basePath,
+	old := p.load()
+	getters := make(map[string]*httpGetter, len(peers))
+	weights := make(map[string]int, len(peers))
+	// 新旧节点的并集，placement 更新期间使用
+	union := make(map[string]*httpGetter, len(peers)+len(old.getters))
+	for peer, getter := range old.getters {
+		union[peer] = getter
+	}
+	var removed []string
+	for peer := range old.getters {
+		if _, ok := peers[peer]; !ok {
+			removed = append(removed, peer)
 		}
 	}
+	// 按固定的顺序加入，哈希冲突时每个节点的结果一致
+	names := make([]string, 0, len(peers))
+	for peer := range peers {
+		names = append(names, peer)
+	}
+	sort.Strings(names)
+	for _, peer := range names {
+		weight := peers[peer]
+		if weight < 1 {
+			weight = 1
+		}
+		weights[peer] = weight
+		getter, ok := old.getters[peer]
+		if !ok {
+			// 为每一个节点创建一个HTTP客户端 httpGetter
+			getter = &httpGetter{
+				baseURL: peer + p.basePath,
+				latency: newHistogram(defaultBuckets),
+			}
+		}
+		getters[peer] = getter
+		union[peer] = getter
+	}
+	if mixed := !uniform(weights); !p.placementSet && mixed != p.mixed {
+		// 权重不全为 1 时切换到打散虚拟节点位置的哈希环，新的环只包含新的节点，与 getters 一起发布
+		ring := consistenthash.New(defaultReplicas, nil)
+		if mixed {
+			ring = consistenthash.NewMixed(defaultReplicas)
+		}
+		for _, peer := range names {
+			ring.AddWeighted(peer, weights[peer])
+		}
+		next := old.with(getters, weights)
+		next.placement = ring
+		p.mixed = mixed
+		p.peers.Store(next)
+		return
+	}
+	p.peers.Store(old.with(union, old.weights))
+	old.placement.Remove(removed...)
+	for _, peer := range names {
+		old.placement.AddWeighted(peer, weights[peer])
+	}
+	p.peers.Store(old.with(getters, weights))
+}
+
+// uniform reports whether all weights are 1.
+func uniform(weights map[string]int) bool {
+	for _, weight := range weights {
+		if weight != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// SetPlacement replaces the algorithm choosing the peer of a key. Nodes already
+// in pl are removed and the current peers are added with their weights, pl
+// must not be changed afterwards. All peers must use the same algorithm. By
+// default a consistent hash ring with 50 virtual nodes is used.
+//
+// Jump numbers the peers by name, adding or removing a peer that does not
+// sort last moves most keys, use it only with names like "cache-01" where new
+// peers sort last.
+func (p *HTTPPool) SetPlacement(pl placement.Placement) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.placementSet = true
+	// 清空 pl，残留的节点没有 getter
+	for nodes := pl.GetN("", 16); len(nodes) > 0; nodes = pl.GetN("", 16) {
+		pl.Remove(nodes...)
+	}
+	old := p.load()
+	names := make([]string, 0, len(old.getters))
+	for peer := range old.getters {
+		names = append(names, peer)
+	}
+	sort.Strings(names)
+	for _, peer := range names {
+		pl.AddWeighted(peer, old.weights[peer])
+	}
+	next := old.with(old.getters, old.weights)
+	next.placement = pl
+	p.peers.Store(next)
 }
 
 // PickPeer picks a peer according to key
 // PickPeer 包装了一致性哈希算法的Get的方法， 根据具体的key，选择节点，返回节点对应的HTTP客户端
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
+	s, peer, getter := p.lookup(key)
+	if peer == "" || peer == p.self {
+		return nil, false
+	}
+	if s.epsilon > 0 {
+		if spill, ok := p.pickBounded(s, key, peer, getter); ok {
+			return spill, true
+		}
+	}
+	p.Log("Pick peer %s", peer)
+	return getter, true
+}
+
+// PickOwner picks the peer owning key, ignoring the bounded loads.
+func (p *HTTPPool) PickOwner(key string) (PeerGetter, bool) {
+	_, peer, getter := p.lookup(key)
+	if peer == "" || peer == p.self {
+		return nil, false
+	}
+	return getter, true
+}
+
+// SetBoundedLoad enables consistent hashing with bounded loads (Mirrokni et
+// al.): a peer with more in-flight requests from this node than (1+epsilon)
+// times the average over the other peers, scaled by its weight, is skipped for
+// the next peer of the key which is within the bound. That peer loads the key
+// itself instead of forwarding it to the owner. The owner is kept when all
+// other peers are full, keys are never spilled to this node. A small epsilon
+// balances better but moves more keys away from their owner. A non-positive
+// epsilon disables it, which is the default.
+// 只统计本节点发出的请求，各节点独立地判断，同一个 key 可能被不同节点发往不同的 peer
+func (p *HTTPPool) SetBoundedLoad(epsilon float64) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
-		p.Log("Pick peer %s", peer)
-		return p.httpGetters[peer], true
+	old := p.load()
+	next := old.with(old.getters, old.weights)
+	next.epsilon = epsilon
+	p.peers.Store(next)
+}
+
+// pickBounded 归属节点 owner 的负载达到上限时，按 GetN 的顺序选择第一个未满的其他节点。
+// 本节点自身的负载无法统计，不计入平均值，也不会被选中
+func (p *HTTPPool) pickBounded(s *peerSet, key, owner string, ownerGetter *httpGetter) (PeerGetter, bool) {
+	var inflight, weights int64
+	for peer, getter := range s.getters {
+		if peer == p.self {
+			continue
+		}
+		inflight += getter.inflight.Get()
+		weights += int64(s.weights[peer])
+	}
+	// 加上本次请求后，每单位权重的负载上限
+	limit := (1 + s.epsilon) * float64(inflight+1) / float64(weights)
+	full := func(peer string, getter *httpGetter) bool {
+		return float64(getter.inflight.Get()+1) > math.Ceil(limit*float64(s.weights[peer]))
+	}
+	if !full(owner, ownerGetter) {
+		return nil, false
+	}
+	for _, peer := range s.placement.GetN(key, len(s.getters)) {
+		getter, ok := s.getters[peer]
+		if !ok || peer == p.self || peer == owner || full(peer, getter) {
+			continue
+		}
+		ownerGetter.spills.Add(1)
+		p.Log("Spill %s from peer %s to %s", key, owner, peer)
+		return spillGetter{getter}, true
 	}
 	return nil, false
 }
 
-var _ PeerPicker = (*HTTPPool)(nil)
+// PickReplica picks the peer owning key after failed, the next node on the ring.
+// failed may be a peer picked to spill the load of the owner, the node after
+// that peer is picked then.
+func (p *HTTPPool) PickReplica(key string, failed PeerGetter) (PeerGetter, bool) {
+	if spill, ok := failed.(spillGetter); ok {
+		failed = spill.httpGetter
+	}
+	// 节点与 getter 来自同一个快照，placement 返回的节点不在快照中时跳过
+	s := p.load()
+	var nodes []string
+	for _, node := range s.placement.GetN(key, len(s.getters)) {
+		if _, ok := s.getters[node]; ok {
+			nodes = append(nodes, node)
+		}
+	}
+	for i := 0; i+1 < len(nodes); i++ {
+		if s.getters[nodes[i]] != failed {
+			continue
+		}
+		next := nodes[i+1]
+		if next == p.self {
+			break
+		}
+		p.Log("Pick replica %s", next)
+		return s.getters[next], true
+	}
+	return nil, false
+}
+
+// ListPeers returns the HTTP clients of all peers except this one.
+func (p *HTTPPool) ListPeers() map[string]PeerGetter {
+	s := p.load()
+	peers := make(map[string]PeerGetter, len(s.getters))
+	for peer, getter := range s.getters {
+		if peer != p.self {
+			peers[peer] = getter
+		}
+	}
+	return peers
+}
+
+var (
+	_ PeerPicker    = (*HTTPPool)(nil)
+	_ PeerLister    = (*HTTPPool)(nil)
+	_ ReplicaPicker = (*HTTPPool)(nil)
+	_ OwnerPicker   = (*HTTPPool)(nil)
+)
 
 type httpGetter struct {
-	baseURL string // baseURL 表示将要访问的远程节点的地址
+	baseURL string     // baseURL 表示将要访问的远程节点的地址
+	latency *histogram // 请求该节点的耗时分布
+	errors  AtomicInt  // 请求该节点失败的次数
+	// fallbackLoads 该节点失败后由本节点代为加载的 key 数
+	fallbackLoads AtomicInt
+	inflight      AtomicInt // 本节点正在等待该节点响应的请求数
+	spills        AtomicInt // 该节点负载过高时改发给其他节点的 key 数
 }
 
-func (h *httpGetter) Get(in *neecachepb.Request, out *neecachepb.Response) error {
-	u := fmt.Sprintf(
+// spillGetter sends requests for keys of an overloaded owner to another peer,
+// they are marked spill so that the peer does not forward them to the owner.
+type spillGetter struct {
+	*httpGetter
+}
+
+func (s spillGetter) Get(ctx context.Context, in *neecachepb.Request, out *neecachepb.Response) error {
+	req := &neecachepb.Request{Group: in.GetGroup(), Key: in.GetKey(), Replica: in.GetReplica(), Spill: true}
+	return s.httpGetter.Get(ctx, req, out)
+}
+
+func (s spillGetter) GetMulti(ctx context.Context, in *neecachepb.BatchRequest, out *neecachepb.BatchResponse) error {
+	req := &neecachepb.BatchRequest{Group: in.GetGroup(), Keys: in.GetKeys(), Spill: true}
+	return s.httpGetter.GetMulti(ctx, req, out)
+}
+
+func (h *httpGetter) countFallbackLoad() {
+	h.fallbackLoads.Add(1)
+}
+
+func (h *httpGetter) Get(ctx context.Context, in *neecachepb.Request, out *neecachepb.Response) error {
+	u := h.url(in.GetGroup(), in.GetKey())
+	switch {
+	case in.GetReplica():
+		u += "?replica=true"
+	case in.GetSpill():
+		u += "?spill=true"
+	}
+	if err := h.roundTrip(ctx, http.MethodGet, u, nil, out); err != nil {
+		return err
+	}
+	if out.GetNotFound() {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Set 使用 PUT 请求将值写入远程节点
+func (h *httpGetter) Set(ctx context.Context, in *neecachepb.SetRequest, out *neecachepb.SetResponse) error {
+	return h.roundTrip(ctx, http.MethodPut, h.url(in.GetGroup(), in.GetKey()), in, out)
+}
+
+// Delete 使用 DELETE 请求删除远程节点上的缓存
+func (h *httpGetter) Delete(ctx context.Context, in *neecachepb.DeleteRequest, out *neecachepb.DeleteResponse) error {
+	return h.roundTrip(ctx, http.MethodDelete, h.url(in.GetGroup(), in.GetKey()), nil, out)
+}
+
+// Invalidate 使用 POST 请求让远程节点删除其所有缓存中的 key
+func (h *httpGetter) Invalidate(ctx context.Context, in *neecachepb.InvalidateRequest, out *neecachepb.InvalidateResponse) error {
+	return h.roundTrip(ctx, http.MethodPost, h.url(in.GetGroup(), in.GetKey()), in, out)
+}
+
+// GetMulti 使用 POST 请求 /<basepath>/_batch/<group> 批量查找
+func (h *httpGetter) GetMulti(ctx context.Context, in *neecachepb.BatchRequest, out *neecachepb.BatchResponse) error {
+	return h.roundTrip(ctx, http.MethodPost, h.url(batchPath, in.GetGroup()), in, out)
+}
+
+// url 返回远程节点的 /<basepath>/<group>/<key>
+func (h *httpGetter) url(group, key string) string {
+	return fmt.Sprintf(
 		"%v%s/%v",
 		h.baseURL,
-		url.QueryEscape(in.GetGroup()),
-		url.QueryEscape(in.GetKey()),
+		url.QueryEscape(group),
+		url.QueryEscape(key),
 	)
-	res, err := http.Get(u)
+}
+
+// roundTrip 请求远程节点的 u，并记录耗时与失败次数
+func (h *httpGetter) roundTrip(ctx context.Context, method, u string, in, out proto.Message) error {
+	h.inflight.Add(1)
+	defer h.inflight.Add(-1)
+	start := time.Now()
+	err := h.do(ctx, method, u, in, out)
+	h.latency.observe(time.Since(start))
+	if err != nil {
+		h.errors.Add(1)
+	}
+	return err
+}
+
+func (h *httpGetter) do(ctx context.Context, method, u string, in, out proto.Message) error {
+	var body io.Reader
+	if in != nil {
+		data, err := proto.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("encoding request body: %v", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
 	if err != nil {
 		return err
 	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// ctx 结束导致的失败不是远程节点的问题
+		if ctx.Err() != nil {
+			return err
+		}
+		return &unavailableError{err}
+	}
 	defer func(Body io.ReadCloser) {
 		err2 := Body.Close()
 		if err2 != nil {
 			err = fmt.Errorf("%v\n%v\n", err.Error(), err2.Error())
 		}
 	}(res.Body)
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: 5v", res.Status)
-	}
 
-	bytes, err := ioutil.ReadAll(res.Body)
+	data, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return fmt.Errorf("reading response body: %v", err)
+		if ctx.Err() != nil {
+			return err
+		}
+		return &unavailableError{fmt.Errorf("reading response body: %v", err)}
+	}
+	if res.StatusCode != http.StatusOK {
+		return newRemoteError(res.StatusCode, data)
 	}
-	if err = proto.Unmarshal(bytes, out); err != nil {
+	if err = proto.Unmarshal(data, out); err != nil {
 		return fmt.Errorf("decoding response body: %v", err)
 	}
 	return nil
@@ -0,0 +1,689 @@
+package neecache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"google.golang.org/protobuf/proto"
+	"io/ioutil"
+	"neecache/neecachepb"
+	"neecache/placement"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSetRemoveRouting(t *testing.T) {
+	loads := 0
+	nee := NewGroup("set-remove", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte("db-" + key), nil
+	}))
+	// 远程节点与本节点在同一进程中，共享同名的 group
+	remote := httptest.NewServer(NewHTTPPool("remote"))
+	defer remote.Close()
+	pool := NewHTTPPool("self")
+	pool.Set(remote.URL)
+	nee.RegisterPeers(pool)
+
+	if err := nee.Set("Tom", []byte("630")); err != nil {
+		t.Fatalf("set Tom through peer failed: %v", err)
+	}
+	if view, ok := nee.mainCache.get("Tom"); !ok || view.String() != "630" {
+		t.Fatalf("owner should cache the value set through the peer")
+	}
+
+	if err := nee.Remove("Tom"); err != nil {
+		t.Fatalf("remove Tom through peer failed: %v", err)
+	}
+	if _, ok := nee.mainCache.get("Tom"); ok {
+		t.Fatalf("owner should drop the value removed through the peer")
+	}
+	if loads != 0 {
+		t.Fatalf("Set and Remove should not call the getter, got %d loads", loads)
+	}
+}
+
+func TestSetRemoveLocally(t *testing.T) {
+	loads := 0
+	nee := NewGroup("set-remove-local", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte("db-" + key), nil
+	}))
+
+	if err := nee.Set("Tom", []byte("630")); err != nil {
+		t.Fatal(err)
+	}
+	if view, err := nee.Get("Tom"); err != nil || view.String() != "630" || loads != 0 {
+		t.Fatalf("get Tom after set failed")
+	}
+	if err := nee.Remove("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if view, err := nee.Get("Tom"); err != nil || view.String() != "db-Tom" || loads != 1 {
+		t.Fatalf("Tom should be loaded again after remove")
+	}
+	if nee.Set("", nil) == nil || nee.Remove("") == nil {
+		t.Fatalf("empty key should be rejected")
+	}
+}
+
+func TestInvalidateBroadcast(t *testing.T) {
+	nee := NewGroup("invalidate", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("db-" + key), nil
+	}))
+	remote := httptest.NewServer(NewHTTPPool("remote"))
+	defer remote.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+	pool := NewHTTPPool("self")
+	pool.Set("self", remote.URL, broken.URL)
+	nee.RegisterPeers(pool)
+
+	nee.setLocally("Tom", []byte("630"))
+	result, err := nee.Invalidate("Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := nee.mainCache.get("Tom"); ok {
+		t.Fatalf("Tom should be invalidated locally")
+	}
+	if len(result.Acked) != 1 || result.Acked[0] != remote.URL {
+		t.Fatalf("expected %s to ack, got %v", remote.URL, result.Acked)
+	}
+	if _, ok := result.Failed[broken.URL]; !ok || len(result.Failed) != 1 || result.OK() {
+		t.Fatalf("expected %s to fail, got %v", broken.URL, result.Failed)
+	}
+
+	// 重试同一个 id 不应删除之后写入的值
+	nee.setLocally("Tom", []byte("631"))
+	if _, err = nee.InvalidateID(result.ID, "Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if view, ok := nee.mainCache.get("Tom"); !ok || view.String() != "631" {
+		t.Fatalf("retried invalidation should be applied only once")
+	}
+	if _, err = nee.Invalidate(""); err == nil {
+		t.Fatalf("empty key should be rejected")
+	}
+}
+
+func TestWriteContextDeadline(t *testing.T) {
+	release := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hung.Close()
+	defer close(release)
+	pool := NewHTTPPoolWithRegistry("self", NewRegistry())
+	pool.Set(hung.URL)
+	nee, _ := pool.registry.NewGroup("write-context", GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}), WithPeers(pool))
+
+	// 卡住的节点在 ctx 结束后报告为失败，而不是一直等待
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	result, err := nee.InvalidateContext(ctx, "Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err, ok := result.Failed[hung.URL]; !ok || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %s to fail with the deadline, got %v", hung.URL, result.Failed)
+	}
+	if err := nee.SetContext(ctx, "Tom", []byte("630")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected Set to give up at the deadline, got %v", err)
+	}
+	if err := nee.RemoveContext(ctx, "Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected Remove to give up at the deadline, got %v", err)
+	}
+}
+
+func TestGetContextDeadline(t *testing.T) {
+	nee := NewGroupCtx("get-context", 2<<10, GetterCtxFunc(func(ctx context.Context, key string) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	// 远程节点一直阻塞到请求方断开连接
+	cancelled := make(chan struct{})
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	defer remote.Close()
+	pool := NewHTTPPool("self")
+	pool.Set(remote.URL)
+	nee.RegisterPeers(pool)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := nee.GetContext(ctx, "Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatalf("request to peer should be cancelled with the deadline")
+	}
+}
+
+func TestNegativeCachePeer(t *testing.T) {
+	loads := 0
+	nee := NewGroup("negative-peer", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte("db-" + key), nil
+	}))
+	nee.SetNegativeTTL(time.Hour)
+	requests := 0
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		writeProto(w, &neecachepb.Response{NotFound: true})
+	}))
+	defer remote.Close()
+	pool := NewHTTPPool("self")
+	pool.Set(remote.URL)
+	nee.RegisterPeers(pool)
+
+	for i := 0; i < 2; i++ {
+		if _, err := nee.Get("unknown"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound from the owner, got %v", err)
+		}
+	}
+	if loads != 0 {
+		t.Fatalf("owner's miss should not fall back to the local getter, got %d loads", loads)
+	}
+	if requests != 1 {
+		t.Fatalf("owner's miss should be remembered, got %d requests", requests)
+	}
+}
+
+func TestGetMulti(t *testing.T) {
+	loads := 0
+	nee := NewGroup("get-multi", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte("db-" + key), nil
+	}))
+	requests := 0
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		data, _ := ioutil.ReadAll(r.Body)
+		in := &neecachepb.BatchRequest{}
+		if err := proto.Unmarshal(data, in); err != nil || r.Method != http.MethodPost {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		out := &neecachepb.BatchResponse{Results: make(map[string]*neecachepb.KeyResult)}
+		for _, key := range in.GetKeys() {
+			switch key {
+			case "missing":
+				out.Results[key] = &neecachepb.KeyResult{NotFound: true}
+			case "broken":
+				out.Results[key] = &neecachepb.KeyResult{Error: "db unavailable"}
+			case "source":
+				out.Results[key] = &neecachepb.KeyResult{Error: "db unavailable", Code: neecachepb.Code_SOURCE_ERROR}
+			default:
+				out.Results[key] = &neecachepb.KeyResult{Value: []byte("remote-" + key)}
+			}
+		}
+		writeProto(w, out)
+	}))
+	defer remote.Close()
+	pool := NewHTTPPool("self")
+	pool.Set(remote.URL)
+	nee.RegisterPeers(pool)
+
+	results := nee.GetMulti([]string{"Tom", "Jack", "Sam", "missing", "broken", "source"})
+	if requests != 1 {
+		t.Fatalf("keys of one peer should be fetched in one request, got %d", requests)
+	}
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		if res := results[key]; res.Err != nil || res.Value.String() != "remote-"+key {
+			t.Fatalf("get %s from peer failed: %v", key, res.Err)
+		}
+	}
+	if !errors.Is(results["missing"].Err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", results["missing"].Err)
+	}
+	// 远程节点加载失败的 key 回退到本地加载
+	if res := results["broken"]; res.Err != nil || res.Value.String() != "db-broken" || loads != 1 {
+		t.Fatalf("broken should be loaded locally, got %v", res.Err)
+	}
+	if err := results["source"].Err; !errors.Is(err, ErrRemote) {
+		t.Fatalf("source error of the owner should not fall back, got %v", err)
+	}
+}
+
+func TestServeGetMulti(t *testing.T) {
+	NewGroup("serve-multi", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, ErrNotFound
+	}))
+	server := httptest.NewServer(NewHTTPPool("server"))
+	defer server.Close()
+	getter := &httpGetter{baseURL: server.URL + defaultBasePath, latency: newHistogram(defaultBuckets)}
+
+	out := &neecachepb.BatchResponse{}
+	in := &neecachepb.BatchRequest{Group: "serve-multi", Keys: []string{"Tom", "Jack", "unknown"}}
+	if err := getter.GetMulti(context.Background(), in, out); err != nil {
+		t.Fatal(err)
+	}
+	if string(out.Results["Tom"].GetValue()) != "630" || string(out.Results["Jack"].GetValue()) != "589" {
+		t.Fatalf("unexpected results %v", out.Results)
+	}
+	if !out.Results["unknown"].GetNotFound() {
+		t.Fatalf("unknown should be reported as not found")
+	}
+}
+
+func TestServeBatchPath(t *testing.T) {
+	r := NewRegistry()
+	if _, err := r.NewGroup(batchPath, GetterFunc(func(key string) ([]byte, error) { return nil, nil })); err == nil {
+		t.Fatalf("%s should not be accepted as a group name", batchPath)
+	}
+	r.NewGroup("batch-path", GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil }))
+	pool := NewHTTPPoolWithRegistry("self", r)
+	body, _ := proto.Marshal(&neecachepb.BatchRequest{Group: "batch-path", Keys: []string{"Tom"}})
+	tests := []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodPost, "/_neecache/_batch/batch-path", http.StatusOK},
+		{http.MethodGet, "/_neecache/_batch/batch-path", http.StatusMethodNotAllowed},
+		// 空 key 的 POST 不再被当作批量查找
+		{http.MethodPost, "/_neecache/batch-path/", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		pool.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, bytes.NewReader(body)))
+		if rec.Code != tt.status {
+			t.Fatalf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.status, rec.Code)
+		}
+	}
+}
+
+func TestPeerErrors(t *testing.T) {
+	source := NewRegistry()
+	source.NewGroup("peer-errors", GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("db unavailable")
+	}))
+	owner := httptest.NewServer(NewHTTPPoolWithRegistry("owner", source))
+	defer owner.Close()
+	empty := httptest.NewServer(NewHTTPPoolWithRegistry("empty", NewRegistry()))
+	defer empty.Close()
+	overloaded := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer overloaded.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	tests := []struct {
+		name        string
+		url         string
+		unavailable bool
+		status      int // 非零时期望 RemoteError
+		code        neecachepb.Code
+		fallback    bool
+	}{
+		{name: "down", url: down.URL, unavailable: true, fallback: true},
+		{name: "source error", url: owner.URL, status: http.StatusInternalServerError, code: neecachepb.Code_SOURCE_ERROR},
+		{name: "no such group", url: empty.URL, status: http.StatusNotFound, fallback: true},
+		{name: "overloaded", url: overloaded.URL, unavailable: true, status: http.StatusServiceUnavailable, fallback: true},
+	}
+	for _, tt := range tests {
+		getter := &httpGetter{baseURL: tt.url + defaultBasePath, latency: newHistogram(defaultBuckets)}
+		in := &neecachepb.Request{Group: "peer-errors", Key: "Tom"}
+		err := getter.Get(context.Background(), in, &neecachepb.Response{})
+		if errors.Is(err, ErrPeerUnavailable) != tt.unavailable {
+			t.Fatalf("%s: expected ErrPeerUnavailable to be %v, got %v", tt.name, tt.unavailable, err)
+		}
+		var remote *RemoteError
+		if errors.As(err, &remote) != (tt.status != 0) || errors.Is(err, ErrRemote) != (tt.status != 0) {
+			t.Fatalf("%s: unexpected remote error %v", tt.name, err)
+		}
+		if remote != nil && (remote.StatusCode != tt.status || remote.Code != tt.code) {
+			t.Fatalf("%s: expected status %d and code %v, got %v", tt.name, tt.status, tt.code, err)
+		}
+
+		loads := 0
+		nee, _ := NewRegistry().NewGroup("peer-errors", GetterFunc(func(key string) ([]byte, error) {
+			loads++
+			return []byte("db-" + key), nil
+		}))
+		pool := NewHTTPPool("self")
+		pool.Set(tt.url)
+		nee.RegisterPeers(pool)
+		view, err := nee.Get("Tom")
+		if tt.fallback && (err != nil || view.String() != "db-Tom" || loads != 1) {
+			t.Fatalf("%s: key should be loaded locally, got %v", tt.name, err)
+		}
+		// 归属节点的数据源出错时直接返回错误，不再访问本地数据源
+		if !tt.fallback && (!errors.Is(err, ErrRemote) || loads != 0) {
+			t.Fatalf("%s: expected the remote error without fallback, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestHTTPPoolSetIncremental(t *testing.T) {
+	pool := NewHTTPPool("a")
+	pool.Set("a", "b", "c")
+	b := pool.load().getters["b"]
+	b.errors.Add(1)
+	owners := make(map[string]string)
+	for _, key := range []string{"Tom", "Jack", "Sam", "Lily", "Lucy"} {
+		owners[key] = pool.load().placement.Get(key)
+	}
+
+	pool.Set("a", "b")
+	if pool.load().getters["b"] != b || b.errors.Get() != 1 {
+		t.Fatalf("getter of a remaining peer should be kept")
+	}
+	if _, ok := pool.load().getters["c"]; ok || len(pool.load().placement.GetN("Tom", 3)) != 2 {
+		t.Fatalf("c should be removed")
+	}
+	for key, owner := range owners {
+		if owner != "c" && pool.load().placement.Get(key) != owner {
+			t.Fatalf("%s should stay on %s", key, owner)
+		}
+	}
+}
+
+func TestHTTPPoolSetWeighted(t *testing.T) {
+	const pools, keys = 20, 10000
+	// 默认的哈希环与 50 个虚拟节点，取多个节点名称不同的集群的平均份额
+	weights := []int{1, 2, 4, 8}
+	node := func(p, i int) string {
+		return "http://10.0." + strconv.Itoa(p) + "." + strconv.Itoa(i+1) + ":8001"
+	}
+	shares := make([]float64, len(weights))
+	for p := 0; p < pools; p++ {
+		pool := NewHTTPPool("self")
+		peers := make(map[string]int)
+		for i, weight := range weights {
+			peers[node(p, i)] = weight
+		}
+		pool.SetWeighted(peers)
+		counts := make(map[string]int)
+		for i := 0; i < keys; i++ {
+			counts[pool.load().placement.Get("key"+strconv.Itoa(i))]++
+		}
+		for i, weight := range weights {
+			shares[i] += float64(counts[node(p, i)]) / (keys * float64(weight) / 15) / pools
+		}
+	}
+	for i, share := range shares {
+		if share < 0.9 || share > 1.1 {
+			t.Errorf("peers with weight %d own %.2f times their share of keys", weights[i], share)
+		}
+	}
+
+	pool := NewHTTPPool("self")
+	pool.SetWeighted(map[string]int{"small": 1, "large": 4})
+	large := pool.load().getters["large"]
+	if !pool.mixed {
+		t.Fatalf("weights other than 1 should use a mixed ring")
+	}
+	pool.SetWeighted(map[string]int{"small": 1, "large": 1})
+	if pool.load().getters["large"] != large {
+		t.Fatalf("getter of a reweighted peer should be kept")
+	}
+	// 权重都为 1 时与 Set 使用相同的虚拟节点位置
+	if pool.mixed {
+		t.Fatalf("equal weights should use the ring of Set")
+	}
+	counts := make(map[string]int)
+	for i := 0; i < keys; i++ {
+		counts[pool.load().placement.Get("key"+strconv.Itoa(i))]++
+	}
+	if counts["large"] > 2*counts["small"] {
+		t.Fatalf("peers with the same weight should own about the same keys, got %v", counts)
+	}
+}
+
+func TestHTTPPoolSetPlacement(t *testing.T) {
+	pool := NewHTTPPool("self")
+	pool.SetWeighted(map[string]int{"a": 1, "b": 3})
+	pool.SetPlacement(placement.NewMaglev(0))
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		peer, ok := pool.PickPeer("key" + strconv.Itoa(i))
+		if !ok {
+			t.Fatalf("expected a peer")
+		}
+		counts[peer.(*httpGetter).baseURL]++
+	}
+	// 切换算法后保留原有节点的权重
+	a, b := counts["a"+defaultBasePath], counts["b"+defaultBasePath]
+	if ratio := float64(b) / float64(a); ratio < 2.7 || ratio > 3.3 {
+		t.Fatalf("expected b to own 3 times the keys of a, got %d and %d", a, b)
+	}
+	pool.Set("a")
+	if _, ok := pool.PickPeer("Tom"); !ok || len(pool.load().placement.GetN("Tom", 3)) != 1 {
+		t.Fatalf("Set should update the placement")
+	}
+
+	// placement 中已有的节点被清除
+	stale := placement.NewJump()
+	stale.Add("stale1", "stale2")
+	pool.SetPlacement(stale)
+	for i := 0; i < 100; i++ {
+		peer, ok := pool.PickPeer("key" + strconv.Itoa(i))
+		if !ok || peer.(*httpGetter) == nil || peer.(*httpGetter).baseURL != "a"+defaultBasePath {
+			t.Fatalf("stale nodes of the placement should be removed")
+		}
+	}
+}
+
+func TestHTTPPoolConcurrentSet(t *testing.T) {
+	pool := NewHTTPPool("self")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			pool.Set("self", "a", "b"+strconv.Itoa(i%3))
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		// 节点变更期间选出的节点总有对应的 getter
+		for _, key := range []string{"Tom", "Jack", "Sam"} {
+			if peer, ok := pool.PickPeer(key); ok && peer.(*httpGetter) == nil {
+				t.Fatalf("picked a peer without getter for %s", key)
+			}
+		}
+	}
+}
+
+func TestHTTPPoolBoundedLoad(t *testing.T) {
+	pool := NewHTTPPool("self")
+	pool.Set("self", "a", "b", "c")
+	var key string
+	for i := 0; ; i++ {
+		key = "key" + strconv.Itoa(i)
+		if pool.load().placement.Get(key) != "self" {
+			break
+		}
+	}
+	owner := pool.load().getters[pool.load().placement.Get(key)]
+	owner.inflight.Add(10)
+
+	// 未启用时总是选择归属节点
+	if peer, ok := pool.PickPeer(key); !ok || peer != owner {
+		t.Fatalf("expected the owner without bounded loads")
+	}
+	pool.SetBoundedLoad(0.25)
+	peer, ok := pool.PickPeer(key)
+	spill, isSpill := peer.(spillGetter)
+	if !ok || !isSpill || spill.httpGetter == owner || spill.httpGetter == pool.load().getters["self"] {
+		t.Fatalf("overloaded owner should be skipped for another peer")
+	}
+	if owner.spills.Get() != 1 {
+		t.Fatalf("expected 1 spill, got %d", owner.spills.Get())
+	}
+	// 负载均衡时不溢出
+	owner.inflight.Add(-10)
+	if peer, ok := pool.PickPeer(key); !ok || peer != owner || owner.spills.Get() != 1 {
+		t.Fatalf("owner within the bound should be picked")
+	}
+
+	// 本节点的负载不计入平均值，唯一的远程节点不会溢出到本节点
+	pool.Set("self", "a")
+	a := pool.load().getters["a"]
+	a.inflight.Add(10)
+	for i := 0; i < 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		if pool.load().placement.Get(key) != "a" {
+			continue
+		}
+		if peer, ok := pool.PickPeer(key); !ok || peer != a {
+			t.Fatalf("keys of a should not spill to this node")
+		}
+	}
+}
+
+func TestBoundedLoadSpill(t *testing.T) {
+	var ownerRequests int32
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&ownerRequests, 1)
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer owner.Close()
+
+	// 溢出节点的 group 把 key 路由到归属节点，带 spill 标记的请求在本地加载
+	spillRegistry := NewRegistry()
+	spillPool := NewHTTPPoolWithRegistry("spill", spillRegistry)
+	spillPool.Set("spill", owner.URL)
+	var spillLoads int32
+	spillRegistry.NewGroup("spill", GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(&spillLoads, 1)
+		return []byte("spill-" + key), nil
+	}), WithPeers(spillPool))
+	spill := httptest.NewServer(spillPool)
+	defer spill.Close()
+
+	pool := NewHTTPPoolWithRegistry("self", NewRegistry())
+	pool.Set("self", owner.URL, spill.URL)
+	pool.SetBoundedLoad(0.25)
+	nee, _ := pool.registry.NewGroup("spill", GetterFunc(func(key string) ([]byte, error) {
+		t.Errorf("%s should be loaded by the spill peer", key)
+		return nil, ErrNotFound
+	}), WithPeers(pool))
+	pool.load().getters[owner.URL].inflight.Add(10)
+
+	// 两个节点都认为归属节点是 owner 的 key
+	var keys []string
+	for i := 0; len(keys) < 3; i++ {
+		key := "key" + strconv.Itoa(i)
+		if pool.load().placement.Get(key) == owner.URL && spillPool.load().placement.Get(key) == owner.URL {
+			keys = append(keys, key)
+		}
+	}
+	if view, err := nee.Get(keys[0]); err != nil || view.String() != "spill-"+keys[0] {
+		t.Fatalf("failed to get %s from the spill peer: %q, %v", keys[0], view.String(), err)
+	}
+	for key, res := range nee.GetMulti(keys[1:]) {
+		if res.Err != nil || res.Value.String() != "spill-"+key {
+			t.Fatalf("failed to get %s from the spill peer: %v", key, res.Err)
+		}
+	}
+	if n := atomic.LoadInt32(&ownerRequests); n != 0 {
+		t.Fatalf("spilled keys should not reach the owner, got %d requests", n)
+	}
+	if n := atomic.LoadInt32(&spillLoads); n != 3 {
+		t.Fatalf("expected 3 loads by the spill peer, got %d", n)
+	}
+}
+
+func TestHTTPPoolInflight(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		body, _ := proto.Marshal(&neecachepb.Response{Value: []byte("v")})
+		w.Write(body)
+	}))
+	defer remote.Close()
+	pool := NewHTTPPool("self")
+	pool.Set(remote.URL)
+	getter := pool.load().getters[remote.URL]
+
+	done := make(chan error)
+	go func() {
+		done <- getter.Get(context.Background(), &neecachepb.Request{Group: "g", Key: "Tom"}, &neecachepb.Response{})
+	}()
+	<-started
+	if n := getter.inflight.Get(); n != 1 {
+		t.Fatalf("expected 1 request in flight, got %d", n)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := getter.inflight.Get(); n != 0 {
+		t.Fatalf("expected no request in flight, got %d", n)
+	}
+}
+
+func TestBoundedLoadWritesToOwner(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string][]string)
+	record := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests[name] = append(requests[name], r.Method)
+			mu.Unlock()
+		}))
+	}
+	owner, spill := record("owner"), record("spill")
+	defer owner.Close()
+	defer spill.Close()
+
+	pool := NewHTTPPoolWithRegistry("self", NewRegistry())
+	pool.Set("self", owner.URL, spill.URL)
+	pool.SetBoundedLoad(0.25)
+	nee, _ := pool.registry.NewGroup("writes", GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}), WithPeers(pool))
+	pool.load().getters[owner.URL].inflight.Add(10)
+
+	var key string
+	for i := 0; ; i++ {
+		key = "key" + strconv.Itoa(i)
+		if pool.load().placement.Get(key) == owner.URL {
+			break
+		}
+	}
+	if peer, _ := pool.PickPeer(key); !isSpill(peer) {
+		t.Fatalf("reads of the saturated owner should spill")
+	}
+	// 写入与删除总是发往归属节点
+	if err := nee.Set(key, []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if err := nee.Remove(key); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(requests["owner"], []string{http.MethodPut, http.MethodDelete}) || len(requests["spill"]) != 0 {
+		t.Fatalf("writes should go to the owner only, got %v", requests)
+	}
+}
+
+func isSpill(peer PeerGetter) bool {
+	_, ok := peer.(spillGetter)
+	return ok
+}
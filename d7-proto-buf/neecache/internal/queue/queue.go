@@ -0,0 +1,87 @@
+// Package queue implements the LRU queues shared by the arc and twoq caches.
+package queue
+
+import (
+	"container/list"
+	"neecache/lru"
+	"time"
+)
+
+// Entry is an item of a Queue.
+type Entry struct {
+	Key    string
+	Value  lru.Value // ghost 节点的 Value 为 nil
+	Size   int64
+	Expire time.Time // 过期时间，零值表示永不过期
+}
+
+// Expired reports whether e has expired at now.
+func (e *Entry) Expired(now time.Time) bool {
+	return !e.Expire.IsZero() && !now.Before(e.Expire)
+}
+
+// Queue is a LRU list with a key index and byte accounting, front is the most recent.
+// It is not safe for concurrent access.
+type Queue struct {
+	ll     *list.List
+	items  map[string]*list.Element
+	nbytes int64
+}
+
+// New creates an empty Queue.
+func New() *Queue {
+	return &Queue{ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Lookup returns the element of key, without moving it.
+func (q *Queue) Lookup(key string) (*list.Element, bool) {
+	ele, ok := q.items[key]
+	return ele, ok
+}
+
+// PushFront adds e as the most recent entry.
+func (q *Queue) PushFront(e *Entry) {
+	q.items[e.Key] = q.ll.PushFront(e)
+	q.nbytes += e.Size
+}
+
+// MoveToFront marks the entry of ele as the most recent.
+func (q *Queue) MoveToFront(ele *list.Element) {
+	q.ll.MoveToFront(ele)
+}
+
+// Remove removes ele and returns its entry.
+func (q *Queue) Remove(ele *list.Element) *Entry {
+	e := q.ll.Remove(ele).(*Entry)
+	delete(q.items, e.Key)
+	q.nbytes -= e.Size
+	return e
+}
+
+// RemoveOldest removes and returns the least recent entry, or nil if q is empty.
+func (q *Queue) RemoveOldest() *Entry {
+	if ele := q.ll.Back(); ele != nil {
+		return q.Remove(ele)
+	}
+	return nil
+}
+
+// Front returns the most recent element, or nil if q is empty.
+func (q *Queue) Front() *list.Element {
+	return q.ll.Front()
+}
+
+// Back returns the least recent element, or nil if q is empty.
+func (q *Queue) Back() *list.Element {
+	return q.ll.Back()
+}
+
+// Len returns the number of entries.
+func (q *Queue) Len() int {
+	return q.ll.Len()
+}
+
+// Bytes returns the sum of the sizes of the entries.
+func (q *Queue) Bytes() int64 {
+	return q.nbytes
+}
@@ -0,0 +1,49 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestQueue(t *testing.T) {
+	q := New()
+	q.PushFront(&Entry{Key: "k1", Value: String("v1"), Size: 4})
+	q.PushFront(&Entry{Key: "k2", Value: String("v2"), Size: 4})
+	q.PushFront(&Entry{Key: "k3", Size: 2})
+	if q.Len() != 3 || q.Bytes() != 10 {
+		t.Fatalf("expected 3 entries of 10 bytes, got %d of %d", q.Len(), q.Bytes())
+	}
+	ele, ok := q.Lookup("k1")
+	if !ok {
+		t.Fatalf("k1 should be found")
+	}
+	q.MoveToFront(ele)
+	// k2 成为最久未访问的节点
+	if e := q.RemoveOldest(); e == nil || e.Key != "k2" || q.Bytes() != 6 {
+		t.Fatalf("expected to remove k2, got %v", e)
+	}
+	if _, ok := q.Lookup("k2"); ok {
+		t.Fatalf("removed k2 should not be found")
+	}
+	q.Remove(q.Front())
+	q.RemoveOldest()
+	if q.RemoveOldest() != nil || q.Len() != 0 || q.Bytes() != 0 {
+		t.Fatalf("queue should be empty")
+	}
+}
+
+func TestEntryExpired(t *testing.T) {
+	now := time.Now()
+	if (&Entry{}).Expired(now) {
+		t.Fatalf("zero expire should never expire")
+	}
+	if !(&Entry{Expire: now}).Expired(now) || (&Entry{Expire: now.Add(time.Second)}).Expired(now) {
+		t.Fatalf("entry should expire at its expire time")
+	}
+}
@@ -0,0 +1,142 @@
+package neecache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"neecache/lru"
+	"neecache/neecachepb"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// invalidationLogBytes 记录已执行的失效 id 所用的内存
+	invalidationLogBytes = 64 << 10
+	// invalidationLogTTL 失效 id 的保留时间，超过该时间的重试会被再次执行
+	invalidationLogTTL = 10 * time.Minute
+)
+
+// InvalidationResult summarizes an invalidation broadcast to all peers.
+type InvalidationResult struct {
+	ID     string           // 本次失效的 id，所有节点和重试共用
+	Acked  []string         // 确认删除的节点地址，按字典序排列
+	Failed map[string]error // 请求失败的节点地址及其错误
+}
+
+// OK reports whether every peer acknowledged the invalidation.
+func (r *InvalidationResult) OK() bool {
+	return len(r.Failed) == 0
+}
+
+// Invalidate drops key from the caches of this peer and of all peers known to
+// the registered PeerPicker, whether they own the key or mirror it in their
+// hot cache. Peers that failed can be retried with InvalidateID and the same id.
+// Peers not answering within defaultWriteTimeout are reported as failed.
+func (g *Group) Invalidate(key string) (*InvalidationResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultWriteTimeout)
+	defer cancel()
+	return g.InvalidateContext(ctx, key)
+}
+
+// InvalidateContext is like Invalidate, peers not answering before ctx is
+// done are reported as failed.
+func (g *Group) InvalidateContext(ctx context.Context, key string) (*InvalidationResult, error) {
+	id, err := newInvalidationID()
+	if err != nil {
+		return nil, err
+	}
+	return g.InvalidateIDContext(ctx, id, key)
+}
+
+// InvalidateID is like Invalidate with a caller provided id. An invalidation
+// is applied at most once per peer for a given id, so retrying it never drops
+// a value set after the first attempt.
+func (g *Group) InvalidateID(id, key string) (*InvalidationResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultWriteTimeout)
+	defer cancel()
+	return g.InvalidateIDContext(ctx, id, key)
+}
+
+// InvalidateIDContext is like InvalidateID, peers not answering before ctx is
+// done are reported as failed.
+// 并发地向所有节点广播失效请求，并汇总成功与失败的节点
+func (g *Group) InvalidateIDContext(ctx context.Context, id, key string) (*InvalidationResult, error) {
+	if key == "" {
+		return nil, fmt.Errorf("key is required")
+	}
+	if id == "" {
+		return nil, fmt.Errorf("invalidation id is required")
+	}
+	g.invalidateLocally(id, key)
+
+	result := &InvalidationResult{ID: id, Failed: make(map[string]error)}
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return result, nil
+	}
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for addr, peer := range lister.ListPeers() {
+		wg.Add(1)
+		go func(addr string, peer PeerGetter) {
+			defer wg.Done()
+			req := &neecachepb.InvalidateRequest{
+				Group: g.name,
+				Key:   key,
+				Id:    id,
+			}
+			err := peer.Invalidate(ctx, req, &neecachepb.InvalidateResponse{})
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				result.Failed[addr] = err
+				return
+			}
+			result.Acked = append(result.Acked, addr)
+		}(addr, peer)
+	}
+	wg.Wait()
+	sort.Strings(result.Acked)
+	return result, nil
+}
+
+// invalidateLocally removes key from both caches unless id was already applied.
+func (g *Group) invalidateLocally(id, key string) bool {
+	if g.invalidations.seen(id) {
+		return false
+	}
+	return g.removeLocally(key)
+}
+
+// invalidationLog remembers recently applied invalidation ids.
+type invalidationLog struct {
+	mu  sync.Mutex
+	ids *lru.Cache
+}
+
+// seen records id and reports whether it was recorded before.
+func (l *invalidationLog) seen(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ids == nil {
+		l.ids = lru.New(invalidationLogBytes, nil)
+	}
+	if _, ok := l.ids.Get(id); ok {
+		return true
+	}
+	l.ids.AddWithTTL(id, ByteView{}, invalidationLogTTL)
+	return false
+}
+
+func newInvalidationID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,207 @@
+package lfu
+
+import (
+	"container/list"
+	"neecache/lru"
+	"time"
+)
+
+// Cache is a LFU cache. It is not safe for concurrent access.
+// 每个访问频次对应一个桶，桶按频次升序串成链表，桶内按最近访问排序（front 是最近访问），
+// 淘汰时选择第一个桶中最久未访问的节点。空桶立即删除，Get/Add/Remove/淘汰均为 O(1)
+type Cache struct {
+	maxBytes int64 // 允许使用的最大内存
+	nbytes   int64 // 当前已使用的内存
+	cache    map[string]*list.Element
+	buckets  *list.List // *bucket，按频次升序，front 是最小频次
+	// optional and executed when an entry is purged
+	OnEvicted func(key string, value lru.Value, reason lru.EvictReason)
+	now       func() time.Time
+}
+
+type entry struct {
+	key    string
+	value  lru.Value
+	expire time.Time     // 过期时间，零值表示永不过期
+	bucket *list.Element // 所在的桶
+}
+
+// bucket holds the entries accessed freq times.
+type bucket struct {
+	freq    int
+	entries *list.List
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+func (e *entry) size() int64 {
+	return int64(len(e.key)) + int64(e.value.Len())
+}
+
+// New is the constructor of Cache
+func New(maxBytes int64, onEvicted func(string, lru.Value, lru.EvictReason)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*list.Element),
+		buckets:   list.New(),
+		OnEvicted: onEvicted,
+		now:       time.Now,
+	}
+}
+
+// Get look ups a key`s value and increases its frequency.
+func (c *Cache) Get(key string) (value lru.Value, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		if kv.expired(c.now()) {
+			c.removeElement(ele, lru.EvictExpired)
+			return nil, false
+		}
+		c.touch(ele)
+		return kv.value, true
+	}
+	return
+}
+
+// touch 将节点移动到下一个频次的桶，桶不存在时插入到当前桶之后
+func (c *Cache) touch(ele *list.Element) *list.Element {
+	kv := ele.Value.(*entry)
+	cur := kv.bucket
+	freq := cur.Value.(*bucket).freq + 1
+	next := cur.Next()
+	if next == nil || next.Value.(*bucket).freq != freq {
+		next = c.buckets.InsertAfter(&bucket{freq: freq, entries: list.New()}, cur)
+	}
+	c.unlink(ele)
+	kv.bucket = next
+	ele = next.Value.(*bucket).entries.PushFront(kv)
+	c.cache[kv.key] = ele
+	return ele
+}
+
+// unlink 从桶中删除节点，桶为空时删除桶
+func (c *Cache) unlink(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	b := kv.bucket.Value.(*bucket)
+	b.entries.Remove(ele)
+	if b.entries.Len() == 0 {
+		c.buckets.Remove(kv.bucket)
+	}
+}
+
+// Add adds a value to the cache.
+func (c *Cache) Add(key string, value lru.Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithTTL adds a value to the cache which expires after ttl.
+// A non-positive ttl means the value never expires.
+func (c *Cache) AddWithTTL(key string, value lru.Value, ttl time.Duration) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = c.now().Add(ttl)
+	}
+	c.AddWithExpire(key, value, expire)
+}
+
+// AddWithExpire adds a value to the cache which expires at the given time.
+// A zero expire means the value never expires.
+func (c *Cache) AddWithExpire(key string, value lru.Value, expire time.Time) {
+	if ele, ok := c.cache[key]; ok {
+		// 更新已有节点视为一次访问
+		kv := c.touch(ele).Value.(*entry)
+		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
+		kv.value = value
+		kv.expire = expire
+	} else {
+		kv := &entry{key: key, value: value, expire: expire}
+		// 先腾出空间再插入，避免新节点因频次最低而被立刻淘汰
+		for c.maxBytes != 0 && c.nbytes > 0 && c.maxBytes < c.nbytes+kv.size() {
+			c.RemoveOldest()
+		}
+		front := c.buckets.Front()
+		if front == nil || front.Value.(*bucket).freq != 1 {
+			front = c.buckets.PushFront(&bucket{freq: 1, entries: list.New()})
+		}
+		kv.bucket = front
+		c.cache[key] = front.Value.(*bucket).entries.PushFront(kv)
+		c.nbytes += kv.size()
+	}
+
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+// RemoveOldest removes the least frequently used item,
+// the least recently used one is chosen among items with the same frequency.
+func (c *Cache) RemoveOldest() {
+	if ele := c.victim(); ele != nil {
+		c.removeElement(ele, lru.EvictCapacity)
+	}
+}
+
+func (c *Cache) victim() *list.Element {
+	if front := c.buckets.Front(); front != nil {
+		return front.Value.(*bucket).entries.Back()
+	}
+	return nil
+}
+
+// Contains reports whether key is cached, without updating its frequency.
+func (c *Cache) Contains(key string) bool {
+	_, ok := c.cache[key]
+	return ok
+}
+
+// Victim returns the key RemoveOldest would evict next.
+func (c *Cache) Victim() (key string, ok bool) {
+	if ele := c.victim(); ele != nil {
+		return ele.Value.(*entry).key, true
+	}
+	return "", false
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele, lru.EvictRemoved)
+		return true
+	}
+	return false
+}
+
+// RemoveExpired removes all expired items and returns how many were removed.
+func (c *Cache) RemoveExpired() int {
+	now := c.now()
+	n := 0
+	for _, ele := range c.cache {
+		if ele.Value.(*entry).expired(now) {
+			c.removeElement(ele, lru.EvictExpired)
+			n++
+		}
+	}
+	return n
+}
+
+func (c *Cache) removeElement(ele *list.Element, reason lru.EvictReason) {
+	kv := ele.Value.(*entry)
+	c.unlink(ele)
+	delete(c.cache, kv.key)
+	c.nbytes -= kv.size()
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value, reason)
+	}
+}
+
+// Len the number of cache entries
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Bytes returns the number of bytes used by keys and values.
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
@@ -0,0 +1,135 @@
+package lfu
+
+import (
+	"neecache/lru"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestCache_Get(t *testing.T) {
+	c := New(int64(0), nil)
+	c.Add("key1", String("1234"))
+	if v, ok := c.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := c.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestRemoveOldest(t *testing.T) {
+	k1, k2, k3 := "key1", "key2", "key3"
+	v1, v2, v3 := "value1", "value2", "value3"
+	size := len(k1 + k2 + v1 + v2)
+	c := New(int64(size), nil)
+	c.Add(k1, String(v1))
+	c.Add(k2, String(v2))
+	c.Add(k3, String(v3))
+
+	if _, ok := c.Get("key1"); ok || c.Len() != 2 {
+		t.Fatalf("RemoveOldest key1 failed")
+	}
+}
+
+func TestOnEvicted(t *testing.T) {
+	keys := make([]string, 0)
+	callback := func(key string, value lru.Value, reason lru.EvictReason) {
+		keys = append(keys, key)
+	}
+	c := New(int64(10), callback)
+	c.Add("key1", String("123456"))
+	c.Add("k2", String("k2"))
+	c.Add("k3", String("k3"))
+	c.Add("k4", String("k4"))
+
+	expect := []string{"key1", "k2"}
+	if !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Call OnEvicted failed, expect keys equals to %s, got %s", expect, keys)
+	}
+	if c.Bytes() > 10 {
+		t.Fatalf("now: %d, max: %d", c.Bytes(), 10)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	now := time.Now()
+	reasons := make(map[string]lru.EvictReason)
+	c := New(int64(0), func(key string, value lru.Value, reason lru.EvictReason) {
+		reasons[key] = reason
+	})
+	c.now = func() time.Time { return now }
+	c.AddWithTTL("k1", String("v1"), time.Second)
+	c.AddWithTTL("k2", String("v2"), time.Minute)
+	c.Add("k3", String("v3"))
+	c.Add("k4", String("v4"))
+
+	now = now.Add(2 * time.Second)
+	if _, ok := c.Get("k1"); ok {
+		t.Fatalf("lazy expire k1 failed")
+	}
+	now = now.Add(time.Minute)
+	if n := c.RemoveExpired(); n != 1 || c.Len() != 2 {
+		t.Fatalf("RemoveExpired removed %d, left %d", n, c.Len())
+	}
+	if !c.Remove("k4") || c.Remove("k4") {
+		t.Fatalf("Remove k4 failed")
+	}
+	if _, ok := c.Get("k3"); !ok || c.Bytes() != int64(len("k3")+len("v3")) {
+		t.Fatalf("k3 without ttl should never expire")
+	}
+
+	expect := map[string]lru.EvictReason{"k1": lru.EvictExpired, "k2": lru.EvictExpired, "k4": lru.EvictRemoved}
+	if !reflect.DeepEqual(expect, reasons) {
+		t.Fatalf("Call OnEvicted with reasons %v, expect %v", reasons, expect)
+	}
+}
+
+func TestFrequency(t *testing.T) {
+	c := New(int64(len("k1v1")*3), nil)
+	c.Add("k1", String("v1"))
+	c.Add("k2", String("v2"))
+	c.Add("k3", String("v3"))
+	c.Get("k1")
+	c.Get("k1")
+	c.Get("k2")
+	c.Add("k4", String("v4"))
+
+	if _, ok := c.Get("k3"); ok {
+		t.Fatalf("least frequently used k3 should be evicted")
+	}
+	for _, k := range []string{"k1", "k2", "k4"} {
+		if _, ok := c.Get(k); !ok {
+			t.Fatalf("%s should not be evicted", k)
+		}
+	}
+}
+
+func TestVictimAfterRemove(t *testing.T) {
+	c := New(int64(0), nil)
+	c.Add("k1", String("v1"))
+	c.Add("k2", String("v2"))
+	c.Add("k3", String("v3"))
+	c.Get("k2")
+	c.Get("k3")
+	c.Get("k3")
+	// 删除最小频次的唯一节点后，下一个淘汰的是频次次小的节点，不留下空桶
+	c.Remove("k1")
+	if key, ok := c.Victim(); !ok || key != "k2" {
+		t.Fatalf("expected victim k2, got %s", key)
+	}
+	if n := c.buckets.Len(); n != 2 {
+		t.Fatalf("expected 2 frequency buckets, got %d", n)
+	}
+	c.Remove("k2")
+	c.Remove("k3")
+	if _, ok := c.Victim(); ok || c.buckets.Len() != 0 {
+		t.Fatalf("empty cache should have no victim nor buckets")
+	}
+}
@@ -1,9 +1,36 @@
 package lru
 
-import "container/list"
+import (
+	"container/list"
+	"time"
+)
 
 // 约定front 是队尾
 
+// EvictReason describes why an entry left the cache.
+type EvictReason int
+
+const (
+	// EvictCapacity 内存超出 maxBytes，淘汰最久未访问的节点
+	EvictCapacity EvictReason = iota
+	// EvictExpired 节点已过期，在 Get 时惰性删除或被后台清理
+	EvictExpired
+	// EvictRemoved 调用方主动删除
+	EvictRemoved
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictExpired:
+		return "expired"
+	case EvictRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
 // Cache is LRU cache. It is not safe for concurrent access.
 type Cache struct {
 	maxBytes int64 // 允许使用的最大内存
@@ -11,12 +38,18 @@ type Cache struct {
 	ll       *list.List
 	cache    map[string]*list.Element
 	// optional and executed when an entry is purged
-	OnEvicted func(key string, value Value)
+	OnEvicted func(key string, value Value, reason EvictReason)
+	now       func() time.Time // 获取当前时间，测试时可替换
 }
 
 type entry struct {
-	key   string
-	value Value
+	key    string
+	value  Value
+	expire time.Time // 过期时间，零值表示永不过期
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
 }
 
 // Value use Len to count how many bytes it takes
@@ -25,20 +58,26 @@ type Value interface {
 }
 
 // New is the constructor of cache
-func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+func New(maxBytes int64, onEvicted func(string, Value, EvictReason)) *Cache {
 	return &Cache{
 		maxBytes:  maxBytes,
 		ll:        list.New(),
 		cache:     make(map[string]*list.Element),
 		OnEvicted: onEvicted,
+		now:       time.Now,
 	}
 }
 
 // Get look ups a key`s value
 func (c *Cache) Get(key string) (value Value, ok bool) {
 	if ele, ok := c.cache[key]; ok {
-		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
+		// 惰性过期：访问到已过期的节点时直接删除，视为未命中
+		if kv.expired(c.now()) {
+			c.removeElement(ele, EvictExpired)
+			return nil, false
+		}
+		c.ll.MoveToFront(ele)
 		return kv.value, true
 	}
 	return
@@ -49,29 +88,89 @@ func (c *Cache) RemoveOldest() {
 	// c.ll.Back() 取到队首节点，从链表中删除
 	ele := c.ll.Back()
 	if ele != nil {
-		c.ll.Remove(ele)
-		kv := ele.Value.(*entry)
-		// 从字典中c.cache 删除该机诶单的影射关系
-		delete(c.cache, kv.key)
-		// 更新当前所用的内存c.nbytes
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
-		// 如果回调函数OnEvicted 不为nil，则调用回调函数
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
+		c.removeElement(ele, EvictCapacity)
+	}
+}
+
+// Contains reports whether key is cached, without updating its recency.
+func (c *Cache) Contains(key string) bool {
+	_, ok := c.cache[key]
+	return ok
+}
+
+// Victim returns the key RemoveOldest would evict next.
+func (c *Cache) Victim() (key string, ok bool) {
+	if ele := c.ll.Back(); ele != nil {
+		return ele.Value.(*entry).key, true
+	}
+	return "", false
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele, EvictRemoved)
+		return true
+	}
+	return false
+}
+
+// RemoveExpired removes all expired items and returns how many were removed.
+// 由后台清理协程定期调用，避免过期但不再被访问的节点一直占用内存
+func (c *Cache) RemoveExpired() int {
+	now := c.now()
+	n := 0
+	for ele := c.ll.Back(); ele != nil; {
+		prev := ele.Prev()
+		if ele.Value.(*entry).expired(now) {
+			c.removeElement(ele, EvictExpired)
+			n++
 		}
+		ele = prev
+	}
+	return n
+}
+
+func (c *Cache) removeElement(ele *list.Element, reason EvictReason) {
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	// 从字典中c.cache 删除该节点的映射关系
+	delete(c.cache, kv.key)
+	// 更新当前所用的内存c.nbytes
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	// 如果回调函数OnEvicted 不为nil，则调用回调函数
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value, reason)
 	}
 }
 
 // Add adds a value to the cache.
 func (c *Cache) Add(key string, value Value) {
-	// 键存在，更新对应节点的值，并将该节点移到队尾部
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithTTL adds a value to the cache which expires after ttl.
+// A non-positive ttl means the value never expires.
+func (c *Cache) AddWithTTL(key string, value Value, ttl time.Duration) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = c.now().Add(ttl)
+	}
+	c.AddWithExpire(key, value, expire)
+}
+
+// AddWithExpire adds a value to the cache which expires at the given time.
+// A zero expire means the value never expires.
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	// 键存在，更新对应节点的值和过期时间，并将该节点移到队尾部
 	if ele, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
 		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
 		kv.value = value
+		kv.expire = expire
 	} else { // 不存在，添加新节点，并字典中添加key和节点的映射关系
-		ele := c.ll.PushFront(&entry{key: key, value: value})
+		ele := c.ll.PushFront(&entry{key: key, value: value, expire: expire})
 		c.cache[key] = ele
 		// 更新c.nbytes 超过最大值 c.maxBytes，则移除最小访问的节点
 		c.nbytes += int64(len(key)) + int64(value.Len())
@@ -86,3 +185,8 @@ func (c *Cache) Add(key string, value Value) {
 func (c *Cache) Len() int {
 	return c.ll.Len()
 }
+
+// Bytes returns the number of bytes used by keys and values.
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
@@ -25,9 +25,9 @@ func TestCache_Get(t *testing.T) {
 }
 
 func TestRemoveOldest(t *testing.T) {
-	k1, k2, k3 := "key1", "key3", "key3"
+	k1, k2, k3 := "key1", "key2", "key3"
 	v1, v2, v3 := "value1", "value2", "value3"
-	size := len(k1 + k2 + k3 + v1 + v2 + v3)
+	size := len(k1 + k2 + v1 + v2)
 	lru := New(int64(size), nil)
 	lru.Add(k1, String(v1))
 	lru.Add(k2, String(v2))
@@ -40,7 +40,7 @@ func TestRemoveOldest(t *testing.T) {
 
 func TestOnEvicted(t *testing.T) {
 	keys := make([]string, 0)
-	callback := func(key string, value Value) {
+	callback := func(key string, value Value, reason EvictReason) {
 		keys = append(keys, key)
 	}
 	lru := New(int64(10), callback)
@@ -56,6 +56,54 @@ func TestOnEvicted(t *testing.T) {
 	t.Logf("now: %d, max: %d\n", lru.nbytes, lru.maxBytes)
 }
 
+func TestExpire(t *testing.T) {
+	now := time.Now()
+	lru := New(int64(0), nil)
+	lru.now = func() time.Time { return now }
+	lru.AddWithTTL("key1", String("1234"), time.Second)
+	lru.Add("key2", String("5678"))
+
+	if _, ok := lru.Get("key1"); !ok {
+		t.Fatalf("cache hit key1 before expire failed")
+	}
+	now = now.Add(time.Second)
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 1 {
+		t.Fatalf("lazy expire key1 failed")
+	}
+	if _, ok := lru.Get("key2"); !ok {
+		t.Fatalf("key2 without ttl should never expire")
+	}
+	if lru.Bytes() != int64(len("key2")+len("5678")) {
+		t.Fatalf("nbytes not updated after expire, got %d", lru.Bytes())
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	now := time.Now()
+	reasons := make(map[string]EvictReason)
+	lru := New(int64(0), func(key string, value Value, reason EvictReason) {
+		reasons[key] = reason
+	})
+	lru.now = func() time.Time { return now }
+	lru.AddWithTTL("k1", String("v1"), time.Second)
+	lru.AddWithTTL("k2", String("v2"), time.Minute)
+	lru.AddWithExpire("k3", String("v3"), now.Add(time.Millisecond))
+	lru.Add("k4", String("v4"))
+
+	now = now.Add(2 * time.Second)
+	if n := lru.RemoveExpired(); n != 2 || lru.Len() != 2 {
+		t.Fatalf("RemoveExpired removed %d, left %d", n, lru.Len())
+	}
+	if lru.Remove("k4") != true || lru.Remove("k4") != false {
+		t.Fatalf("Remove k4 failed")
+	}
+
+	expect := map[string]EvictReason{"k1": EvictExpired, "k3": EvictExpired, "k4": EvictRemoved}
+	if !reflect.DeepEqual(expect, reasons) {
+		t.Fatalf("Call OnEvicted with reasons %v, expect %v", reasons, expect)
+	}
+}
+
 var m sync.Mutex
 var set = make(map[int]bool, 0)
 
@@ -0,0 +1,201 @@
+package neecache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const defaultMetricsPath = "/metrics"
+
+// defaultBuckets are the upper bounds in seconds of the latency histogram,
+// the same as the default buckets of the Prometheus client.
+var defaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogram is a latency histogram safe for concurrent use.
+// 每个桶只记录落在该区间内的次数，输出时再累加成 Prometheus 要求的累计值
+type histogram struct {
+	buckets []float64
+	counts  []int64 // len(buckets)+1，最后一个是 +Inf
+	sum     int64   // 纳秒
+	count   int64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]int64, len(buckets)+1),
+	}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := sort.SearchFloat64s(h.buckets, d.Seconds())
+	atomic.AddInt64(&h.counts[i], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+	atomic.AddInt64(&h.count, 1)
+}
+
+// MetricsHandler returns a handler that renders the statistics of all groups
+// and of the peers of the pool in the Prometheus text exposition format.
+// HTTPPool 默认在 /metrics 上提供该接口
+func (p *HTTPPool) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		p.WriteMetrics(w)
+	})
+}
+
+// WriteMetrics writes the metrics in the Prometheus text exposition format to w.
+func (p *HTTPPool) WriteMetrics(w io.Writer) {
+	mw := &metricWriter{w: bufio.NewWriter(w)}
+	defer mw.w.Flush()
+
+	groups := p.registry.sortedGroups()
+	groupCounters := []struct {
+		name, help string
+		value      func(g *Group) *AtomicInt
+	}{
+		{"neecache_gets_total", "Get requests, including from peers.", func(g *Group) *AtomicInt { return &g.Stats.Gets }},
+		{"neecache_cache_hits_total", "Get requests served by either cache.", func(g *Group) *AtomicInt { return &g.Stats.CacheHits }},
+		{"neecache_misses_total", "Get requests that missed both caches.", func(g *Group) *AtomicInt { return &g.Stats.Misses }},
+		{"neecache_peer_loads_total", "Values loaded from peers.", func(g *Group) *AtomicInt { return &g.Stats.PeerLoads }},
+		{"neecache_peer_errors_total", "Failed loads from peers.", func(g *Group) *AtomicInt { return &g.Stats.PeerErrors }},
+		{"neecache_local_loads_total", "Values loaded by the getter.", func(g *Group) *AtomicInt { return &g.Stats.LocalLoads }},
+		{"neecache_local_load_errors_total", "Failed loads by the getter.", func(g *Group) *AtomicInt { return &g.Stats.LocalLoadErrs }},
+		{"neecache_deduped_loads_total", "Misses that shared an in-flight load.", func(g *Group) *AtomicInt { return &g.Stats.DedupedLoads }},
+		{"neecache_negative_hits_total", "Get requests served by a remembered miss.", func(g *Group) *AtomicInt { return &g.Stats.NegativeHits }},
+		{"neecache_filtered_keys_total", "Misses rejected by the key filter.", func(g *Group) *AtomicInt { return &g.Stats.FilteredKeys }},
+		{"neecache_refreshes_total", "Background reloads started by refresh-ahead.", func(g *Group) *AtomicInt { return &g.Stats.Refreshes }},
+		{"neecache_stale_hits_total", "Expired values served because reloading failed.", func(g *Group) *AtomicInt { return &g.Stats.StaleHits }},
+		{"neecache_fallback_loads_total", "Local loads of keys whose owning peer failed.", func(g *Group) *AtomicInt { return &g.Stats.FallbackLoads }},
+		{"neecache_server_requests_total", "Get requests that came over the network from peers.", func(g *Group) *AtomicInt { return &g.Stats.ServerRequests }},
+	}
+	for _, c := range groupCounters {
+		mw.header(c.name, c.help, "counter")
+		for _, g := range groups {
+			mw.sample(c.name, labels("group", g.name), float64(c.value(g).Get()))
+		}
+	}
+
+	cacheMetrics := []struct {
+		name, help, typ string
+		value           func(s CacheStats) int64
+	}{
+		{"neecache_cache_bytes", "Bytes used by cached keys and values.", "gauge", func(s CacheStats) int64 { return s.Bytes }},
+		{"neecache_cache_items", "Number of cached items.", "gauge", func(s CacheStats) int64 { return s.Items }},
+		{"neecache_cache_gets_total", "Lookups in the cache.", "counter", func(s CacheStats) int64 { return s.Gets }},
+		{"neecache_cache_lookup_hits_total", "Lookups that hit the cache.", "counter", func(s CacheStats) int64 { return s.Hits }},
+		{"neecache_cache_evictions_total", "Items evicted by capacity or expiration.", "counter", func(s CacheStats) int64 { return s.Evictions }},
+	}
+	stats := make([][3]CacheStats, len(groups))
+	for i, g := range groups {
+		stats[i] = [3]CacheStats{g.CacheStats(MainCache), g.CacheStats(HotCache), g.CacheStats(NegativeCache)}
+	}
+	for _, m := range cacheMetrics {
+		mw.header(m.name, m.help, m.typ)
+		for i, g := range groups {
+			mw.sample(m.name, labels("group", g.name, "cache", "main"), float64(m.value(stats[i][0])))
+			mw.sample(m.name, labels("group", g.name, "cache", "hot"), float64(m.value(stats[i][1])))
+			mw.sample(m.name, labels("group", g.name, "cache", "negative"), float64(m.value(stats[i][2])))
+		}
+	}
+
+	// 未启用准入过滤时为 0
+	const admitted, rejected = "neecache_admission_admitted_total", "neecache_admission_rejected_total"
+	admissions := make([][2]int64, len(groups))
+	for i, g := range groups {
+		admissions[i][0], admissions[i][1] = g.AdmissionStats()
+	}
+	mw.header(admitted, "Values admitted into the main cache by the admission filter.", "counter")
+	for i, g := range groups {
+		mw.sample(admitted, labels("group", g.name), float64(admissions[i][0]))
+	}
+	mw.header(rejected, "Values rejected from the main cache by the admission filter.", "counter")
+	for i, g := range groups {
+		mw.sample(rejected, labels("group", g.name), float64(admissions[i][1]))
+	}
+
+	snapshot := p.load()
+	getters := snapshot.getters
+	peers := make([]string, 0, len(getters))
+	for peer := range getters {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+
+	const latency = "neecache_peer_request_duration_seconds"
+	mw.header(latency, "Latency of requests to peers.", "histogram")
+	for _, peer := range peers {
+		h := getters[peer].latency
+		var cumulative int64
+		for i, le := range h.buckets {
+			cumulative += atomic.LoadInt64(&h.counts[i])
+			mw.sample(latency+"_bucket", labels("peer", peer, "le", formatFloat(le)), float64(cumulative))
+		}
+		mw.sample(latency+"_bucket", labels("peer", peer, "le", "+Inf"), float64(atomic.LoadInt64(&h.count)))
+		mw.sample(latency+"_sum", labels("peer", peer), time.Duration(atomic.LoadInt64(&h.sum)).Seconds())
+		mw.sample(latency+"_count", labels("peer", peer), float64(atomic.LoadInt64(&h.count)))
+	}
+	const peerErrors = "neecache_peer_request_errors_total"
+	mw.header(peerErrors, "Failed requests to peers.", "counter")
+	for _, peer := range peers {
+		mw.sample(peerErrors, labels("peer", peer), float64(getters[peer].errors.Get()))
+	}
+	const fallbackLoads = "neecache_peer_fallback_loads_total"
+	mw.header(fallbackLoads, "Keys loaded locally on behalf of a failed peer.", "counter")
+	for _, peer := range peers {
+		mw.sample(fallbackLoads, labels("peer", peer), float64(getters[peer].fallbackLoads.Get()))
+	}
+	const inflight = "neecache_peer_inflight_requests"
+	mw.header(inflight, "Requests to peers in flight.", "gauge")
+	for _, peer := range peers {
+		mw.sample(inflight, labels("peer", peer), float64(getters[peer].inflight.Get()))
+	}
+	const spills = "neecache_peer_spills_total"
+	mw.header(spills, "Keys sent to another peer because the owner was over its load bound.", "counter")
+	for _, peer := range peers {
+		mw.sample(spills, labels("peer", peer), float64(getters[peer].spills.Get()))
+	}
+	const epsilon = "neecache_bounded_load_epsilon"
+	mw.header(epsilon, "Load bound of peers relative to the average load, 0 when disabled.", "gauge")
+	mw.sample(epsilon, "", snapshot.epsilon)
+}
+
+type metricWriter struct {
+	w *bufio.Writer
+}
+
+func (mw *metricWriter) header(name, help, typ string) {
+	fmt.Fprintf(mw.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (mw *metricWriter) sample(name, labels string, value float64) {
+	fmt.Fprintf(mw.w, "%s{%s} %s\n", name, labels, formatFloat(value))
+}
+
+// labels renders name/value pairs as Prometheus labels.
+func labels(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
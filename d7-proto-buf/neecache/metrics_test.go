@@ -0,0 +1,106 @@
+package neecache
+
+import (
+	"bufio"
+	"neecache/neecachepb"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+var sampleLine = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{[^}]*\})? (\S+)$`)
+
+// parseMetrics parses the Prometheus text exposition format into samples keyed by name and labels.
+func parseMetrics(t *testing.T, body string) map[string]float64 {
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "# HELP ") || strings.HasPrefix(line, "# TYPE ") {
+			continue
+		}
+		m := sampleLine.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("malformed metrics line: %q", line)
+		}
+		v, err := strconv.ParseFloat(m[3], 64)
+		if err != nil {
+			t.Fatalf("malformed metrics value: %q", line)
+		}
+		samples[m[1]+m[2]] = v
+	}
+	return samples
+}
+
+func TestMetrics(t *testing.T) {
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := proto.Marshal(&neecachepb.Response{Value: []byte("630")})
+		_, _ = w.Write(body)
+	}))
+	defer remote.Close()
+
+	pool := NewHTTPPool("self")
+	pool.Set(remote.URL)
+	pool.SetBoundedLoad(0.25)
+	nee := NewGroup("metrics", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	nee.RegisterPeers(pool)
+	if view, err := nee.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("get Tom from remote failed")
+	}
+
+	// 超出容量后准入过滤开始拒绝只访问一次的值
+	admission := NewGroup("metrics-admission", 1000, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	}))
+	admission.EnableAdmission()
+	for i := 0; i < 300; i++ {
+		_, _ = admission.Get("once" + strconv.Itoa(i))
+	}
+	admitted, rejected := admission.AdmissionStats()
+	if rejected == 0 {
+		t.Fatalf("expected rejected values")
+	}
+
+	rec := httptest.NewRecorder()
+	pool.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("unexpected metrics response %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	samples := parseMetrics(t, rec.Body.String())
+
+	peer := `peer="` + remote.URL + `"`
+	expect := map[string]float64{
+		`neecache_gets_total{group="metrics"}`:                                  1,
+		`neecache_misses_total{group="metrics"}`:                                1,
+		`neecache_peer_loads_total{group="metrics"}`:                            1,
+		`neecache_cache_items{group="metrics",cache="main"}`:                    0,
+		`neecache_peer_request_duration_seconds_count{` + peer + `}`:            1,
+		`neecache_peer_request_duration_seconds_bucket{` + peer + `,le="+Inf"}`: 1,
+		`neecache_peer_request_errors_total{` + peer + `}`:                      0,
+		`neecache_peer_inflight_requests{` + peer + `}`:                         0,
+		`neecache_peer_spills_total{` + peer + `}`:                              0,
+		`neecache_bounded_load_epsilon{}`:                                       0.25,
+		`neecache_admission_admitted_total{group="metrics"}`:                    0,
+		`neecache_admission_rejected_total{group="metrics"}`:                    0,
+		`neecache_admission_admitted_total{group="metrics-admission"}`:          float64(admitted),
+		`neecache_admission_rejected_total{group="metrics-admission"}`:          float64(rejected),
+	}
+	for k, v := range expect {
+		if got, ok := samples[k]; !ok || got != v {
+			t.Errorf("%s = %v, expect %v", k, got, v)
+		}
+	}
+}
+
+func TestLabelsEscape(t *testing.T) {
+	if got := labels("group", "a\"b\\c\nd"); got != `group="a\"b\\c\nd"` {
+		t.Fatalf("labels not escaped: %s", got)
+	}
+}
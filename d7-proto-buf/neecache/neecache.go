@@ -1,11 +1,16 @@
 package neecache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand"
 	"neecache/neecachepb"
 	"neecache/singleflight"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 /**
@@ -26,13 +31,91 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// A GetterCtx loads data for a key, it should give up once ctx is done.
+// ctx 来自 GetContext 的调用者，或是发起请求的远程节点，可用于取消慢查询并遵守其截止时间
+type GetterCtx interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// A GetterCtxFunc implements GetterCtx with a function.
+type GetterCtxFunc func(ctx context.Context, key string) ([]byte, error)
+
+// Get implements GetterCtx interface function
+func (f GetterCtxFunc) Get(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// getterNoCtx adapts a Getter to GetterCtx by ignoring ctx.
+type getterNoCtx struct {
+	Getter
+}
+
+func (g getterNoCtx) Get(_ context.Context, key string) ([]byte, error) {
+	return g.Getter.Get(key)
+}
+
+// A BatchGetter loads data for many keys at once, e.g. with a single SQL
+// query. Group uses it for the misses of GetMulti when the Getter passed to
+// NewGroup implements it. Keys missing from the returned map are not found,
+// an error fails all keys.
+// 每个 key 仍然经过 singleflight 去重，已经在加载中的 key 不会再次请求数据源
+type BatchGetter interface {
+	GetMulti(keys []string) (map[string][]byte, error)
+}
+
+// A KeyFilter knows which keys may exist in the source, e.g. a bloom.Filter
+// loaded with all valid keys. It must be safe for concurrent use.
+// 用于防止缓存穿透：请求不存在的 key 时直接返回 ErrNotFound，不会访问远程节点和数据源
+type KeyFilter interface {
+	// MayContain 返回 false 时 key 一定不存在
+	MayContain(key string) bool
+	// Add 记录一个存在的 key，Group.Set 写入的 key 会被加入
+	Add(key string)
+}
+
+// A KeyRemover is a KeyFilter that can forget keys, e.g. a bloom.CountingFilter.
+// Group.Remove removes the key from such a filter, i.e. it treats the key as
+// deleted from the source, while Invalidate keeps it.
+// 每次 Remove 都会删除一次，同一个 key 应当与 Set 或 Add 成对使用
+type KeyRemover interface {
+	Remove(key string) bool
+}
+
 // A Group is a cache namespace and associated data loaded spread over
 // 可以认为是一个缓存的命名空间，拥有唯一的名称name
 type Group struct {
-	name      string
-	getter    Getter // 缓存未命中时获取源数据的回调(callback)
-	mainCache cache  // 实现并发缓存
-	peers     PeerPicker
+	name   string
+	getter GetterCtx // 缓存未命中时获取源数据的回调(callback)
+	// batchGetter 是实现了 BatchGetter 的 getter，用于批量加载，可能为 nil
+	batchGetter BatchGetter
+	mainCache   *shardedCache // 实现并发缓存，按 key 分片以减少锁竞争
+	// hotCache contains keys/values for which this peer is not
+	// authoritative (otherwise they would be in mainCache), but
+	// are popular enough to warrant mirroring in this process to
+	// avoid going over the network to fetch from a peer.
+	// 从远程节点获取的值按 hotFraction 的概率采样放入 hotCache
+	hotCache    *cache
+	hotFraction float64
+	// negativeCache 记录数据源中不存在的 key，negativeTTL 为零时不启用
+	negativeCache *cache
+	negativeTTL   time.Duration
+	keyFilter     KeyFilter // 非 nil 时，缓存未命中的 key 需要先通过过滤器
+	// refreshAhead 数据存活超过 ttl 的该比例后，Get 在后台重新加载，为零时不启用
+	refreshAhead float64
+	refreshing   sync.Map // 正在后台重新加载的 key
+	// fallbackPolicy 归属节点失败时的处理方式
+	fallbackPolicy FallbackPolicy
+	// loadConcurrency GetMulti 同时调用 getter 的最大次数
+	loadConcurrency int
+	// compressor 非 nil 时，不小于 compressThreshold 字节的值压缩后缓存
+	compressor        Compressor
+	compressThreshold int
+	cacheBytes        int64 // mainCache 与 hotCache 共享的内存预算
+	peers             PeerPicker
+	// Stats are statistics on the group.
+	Stats Stats
+	// 已执行过的失效 id，保证同一次失效在每个节点只生效一次
+	invalidations invalidationLog
 	// use singleflight.Group to make sure that
 	// each key is only fetched once
 	loader *singleflight.Group
@@ -47,73 +130,332 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 	g.peers = peers
 }
 
-var (
-	mu     sync.RWMutex
-	groups = make(map[string]*Group)
+// SetTTL sets the default time to live of values cached by the group.
+// A non-positive ttl means values never expire, which is the default.
+// 过期的缓存在 Get 时惰性删除，同时由后台协程定期清理
+func (g *Group) SetTTL(ttl time.Duration) {
+	g.mainCache.setTTL(ttl)
+	g.hotCache.setTTL(ttl)
+}
+
+// SetRefreshAhead makes Get reload a value in the background once it has
+// lived more than fraction of its ttl, so that callers of a popular key do not
+// block on the getter when it expires. The value being reloaded is returned
+// meanwhile. A fraction outside of (0, 1) disables refresh-ahead, the default.
+// 后台加载同样经过 singleflight，每个 key 同时只会有一次加载
+func (g *Group) SetRefreshAhead(fraction float64) {
+	if fraction <= 0 || fraction >= 1 {
+		fraction = 0
+	}
+	g.refreshAhead = fraction
+}
+
+// SetStaleIfError keeps values for maxStale after they expire, and returns such
+// a stale value when reloading it fails. ErrNotFound is not considered a
+// failure. A non-positive maxStale disables stale-if-error, which is the default.
+// It should be called before the group serves any request.
+func (g *Group) SetStaleIfError(maxStale time.Duration) {
+	if maxStale < 0 {
+		maxStale = 0
+	}
+	// 过期的数据在 maxStale 内不会被淘汰策略删除
+	g.mainCache.setStale(maxStale)
+	g.hotCache.setStale(maxStale)
+}
+
+// TTL returns the default time to live of values cached by the group.
+func (g *Group) TTL() time.Duration {
+	return g.mainCache.ttl()
+}
+
+// SetShards splits the cache of the group into n independently locked shards,
+// each one holding 1/n of the cache bytes. Values already cached are dropped.
+// 并发访问量大时，多个分片可以避免所有协程竞争同一把锁
+func (g *Group) SetShards(n int) {
+	g.mainCache.reshard(n)
+}
+
+// EnableAdmission turns on the W-TinyLFU admission filter in front of the cache,
+// so that values accessed only once do not evict frequently accessed ones.
+// Values already cached by the group are dropped.
+// 新加载的数据先进入一个很小的窗口 LRU，被窗口淘汰时由 TinyLFU 决定是否进入主缓存
+func (g *Group) EnableAdmission() {
+	g.mainCache.setAdmission(true)
+}
+
+// AdmissionStats returns how many values the admission filter admitted into
+// and rejected from the cache.
+func (g *Group) AdmissionStats() (admitted, rejected int64) {
+	return g.mainCache.admissionStats()
+}
+
+const (
+	// defaultHotCacheRatio hotCache 默认占用 cacheBytes 的 1/8
+	defaultHotCacheRatio = 8
+	// defaultHotFraction 默认将 1/10 从远程节点获取的值放入 hotCache
+	defaultHotFraction = 0.1
 )
 
+// SetHotCache sets the byte budget of the hot cache and the fraction of values
+// fetched from peers that are mirrored into it. A zero cacheBytes or fraction
+// disables the hot cache. Values already in the hot cache are dropped.
+// It should be called before the group serves any request.
+func (g *Group) SetHotCache(cacheBytes int64, fraction float64) {
+	g.hotCache.resize(cacheBytes)
+	g.hotFraction = fraction
+}
+
+// defaultNegativeCacheRatio negativeCache 默认占用 cacheBytes 的 1/8
+const defaultNegativeCacheRatio = 8
+
+// SetNegativeTTL makes the group remember keys reported as ErrNotFound for ttl,
+// so that repeated requests for them do not reach the getter or the owner.
+// A non-positive ttl disables negative caching, which is the default.
+// It should be called before the group serves any request.
+func (g *Group) SetNegativeTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = 0
+		g.negativeCache.resize(g.negativeCache.cacheBytes)
+	}
+	g.negativeTTL = ttl
+	g.negativeCache.setTTL(ttl)
+}
+
+// SetKeyFilter makes the group consult f on a cache miss, keys that f reports
+// as absent fail with ErrNotFound without loading from the peer or the getter.
+// A nil f disables the check. It should be called before the group serves any request.
+func (g *Group) SetKeyFilter(f KeyFilter) {
+	g.keyFilter = f
+}
+
+// CacheStats returns stats about the provided cache within the group.
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.CacheStats()
+	case HotCache:
+		return g.hotCache.CacheStats()
+	case NegativeCache:
+		return g.negativeCache.CacheStats()
+	default:
+		return CacheStats{}
+	}
+}
+
 // NewGroup create a new instance of Group
-// 用来实例化Group，并且将group存储在全局变量groups中
+// 用来实例化Group，并且将group存储在默认的 Registry 中，名称重复时替换原有的 group。
+// It panics if getter is nil or name is reserved, use NewGroupWithOptions
+// to get an error instead, also for a duplicate name.
 func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+	return NewGroupWithPolicy(name, cacheBytes, PolicyLRU, getter)
+}
+
+// NewGroupWithPolicy create a new instance of Group whose cache
+// evicts entries with the given policy. Like NewGroup, it replaces a group
+// with the same name and panics if getter is nil or name is reserved.
+func NewGroupWithPolicy(name string, cacheBytes int64, policy EvictionPolicy, getter Getter) *Group {
+	if getter == nil {
+		panic("nil Getter")
+	}
+	return mustGroup(DefaultRegistry.newGroup(name, getterNoCtx{getter}, true, WithCacheBytes(cacheBytes), WithPolicy(policy)))
+}
+
+// NewGroupCtx create a new instance of Group whose getter receives
+// the context passed to GetContext. Like NewGroup, it replaces a group with
+// the same name and panics if getter is nil or name is reserved.
+func NewGroupCtx(name string, cacheBytes int64, getter GetterCtx) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
-	mu.Lock()
-	defer mu.Unlock()
+	return mustGroup(DefaultRegistry.newGroup(name, getter, true, WithCacheBytes(cacheBytes)))
+}
+
+func mustGroup(g *Group, err error) *Group {
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+func newGroup(name string, getter GetterCtx, o *options) *Group {
+	var inner interface{} = getter
+	if w, ok := getter.(getterNoCtx); ok {
+		inner = w.Getter
+	}
+	batchGetter, _ := inner.(BatchGetter)
+	hotCacheBytes := o.hotCacheBytes
+	if hotCacheBytes < 0 {
+		hotCacheBytes = o.cacheBytes / defaultHotCacheRatio
+	}
 	g := &Group{
-		name:   name,
-		getter: getter,
-		mainCache: cache{
-			cacheBytes: cacheBytes,
+		name:        name,
+		getter:      getter,
+		batchGetter: batchGetter,
+		mainCache: newShardedCacheFrom(o.shards, &cache{
+			cacheBytes: o.cacheBytes,
+			policy:     o.policy,
+			admission:  o.admission,
+			onEvict:    o.onEvicted,
+		}),
+		hotCache: &cache{
+			cacheBytes: hotCacheBytes,
+			policy:     o.policy,
 		},
-		loader: &singleflight.Group{},
+		hotFraction: o.hotFraction,
+		negativeCache: &cache{
+			cacheBytes: o.cacheBytes / defaultNegativeCacheRatio,
+			policy:     PolicyLRU,
+		},
+		keyFilter:  o.keyFilter,
+		cacheBytes: o.cacheBytes,
+		peers:      o.peers,
+		loader:     &singleflight.Group{},
 	}
-	groups[name] = g
+	g.SetTTL(o.ttl)
+	g.SetNegativeTTL(o.negativeTTL)
+	g.SetRefreshAhead(o.refreshAhead)
+	g.SetStaleIfError(o.maxStale)
+	g.SetCompression(o.compressor, o.compressThreshold)
+	g.SetFallbackPolicy(o.fallbackPolicy)
+	g.SetLoadConcurrency(o.loadConcurrency)
 	return g
 }
 
+// close stops the background sweepers of the group.
+func (g *Group) close() {
+	g.mainCache.close()
+	g.hotCache.close()
+	g.negativeCache.close()
+}
+
 // GetGroup returns the named group previously created with NewGroup
 // or nil if there`s no such group.
 // 用来特定名称的Group，这里使用了只读锁RLock()，因为不涉及任何冲突变量的写操作
 func GetGroup(name string) *Group {
-	mu.RLock()
-	g := groups[name]
-	mu.RUnlock()
-	return g
+	return DefaultRegistry.GetGroup(name)
 }
 
 // Get value for a key from cache
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, ctx is passed to the peer or getter loading the
+// value on a miss, cancelling ctx or reaching its deadline aborts the load.
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
-	// 从mainCache 中查找缓存，如果存在则返回缓存值
-	if v, ok := g.mainCache.get(key); ok {
-		log.Println("[NeeCache] hit")
-		return v, nil
+	value, stale, hit, err := g.lookup(key)
+	if hit {
+		return value, err
 	}
 	// 缓存不存在调用load，load调用getLocally(分布式场景下会调用getFromPeer从
 	// 其他节点获取)，getLocally调用用户回调函数g.getter.Get() 获取源数据，并且将源数据
 	// 添加到缓存mainCache中（通过 populateCache 方法）
-	return g.load(key)
+	value, err = g.load(ctx, key)
+	return g.staleOnError(stale, value, err)
+}
+
+// lookup 依次查找 mainCache、hotCache、负缓存与 key 过滤器，hit 为 true 时直接返回 value 与 err，
+// 否则需要加载 key，stale 是开启 stale-if-error 后保留的过期数据
+func (g *Group) lookup(key string) (value ByteView, stale *entry, hit bool, err error) {
+	g.Stats.Gets.Add(1)
+	now := time.Now()
+	// 从mainCache 中查找缓存，如果存在则返回缓存值
+	e, ok := g.mainCache.getEntry(key)
+	if ok && !e.expired(now) {
+		g.Stats.CacheHits.Add(1)
+		log.Println("[NeeCache] hit")
+		g.maybeRefresh(key, e, now, g.populateCache)
+		return e.ByteView, nil, true, nil
+	}
+	// 其他节点负责的热点数据可能已经镜像在 hotCache 中
+	if !ok {
+		e, ok = g.hotCache.getEntry(key)
+		if ok && !e.expired(now) {
+			g.Stats.CacheHits.Add(1)
+			log.Println("[NeeCache] hot cache hit")
+			g.maybeRefresh(key, e, now, g.addHot)
+			return e.ByteView, nil, true, nil
+		}
+	}
+	if ok {
+		stale = &e
+	}
+	if g.negativeTTL > 0 {
+		if _, ok := g.negativeCache.get(key); ok {
+			g.Stats.CacheHits.Add(1)
+			g.Stats.NegativeHits.Add(1)
+			return ByteView{}, nil, true, ErrNotFound
+		}
+	}
+	if g.keyFilter != nil && !g.keyFilter.MayContain(key) {
+		g.Stats.FilteredKeys.Add(1)
+		return ByteView{}, nil, true, ErrNotFound
+	}
+	g.Stats.Misses.Add(1)
+	return ByteView{}, stale, false, nil
+}
+
+// staleOnError 加载失败时，若存在过期数据则返回过期数据
+func (g *Group) staleOnError(stale *entry, value ByteView, err error) (ByteView, error) {
+	if err != nil && stale != nil && !errors.Is(err, ErrNotFound) {
+		g.Stats.StaleHits.Add(1)
+		log.Println("[NeeCache] serve stale value after load failed:", err)
+		return stale.ByteView, nil
+	}
+	return value, err
+}
+
+// maybeRefresh 数据存活超过 refreshAhead 比例的 ttl 后，启动一个后台协程重新加载，
+// 并用 populate 将新值写回 e 所在的缓存。load 只按采样比例写入 hotCache，
+// 不写回时旧值仍会触发刷新，每次 Get 都会再向远程节点请求一次
+func (g *Group) maybeRefresh(key string, e entry, now time.Time, populate func(key string, value ByteView)) {
+	if g.refreshAhead <= 0 || !e.refreshDue(now, g.refreshAhead) {
+		return
+	}
+	if _, loading := g.refreshing.LoadOrStore(key, struct{}{}); loading {
+		return
+	}
+	g.Stats.Refreshes.Add(1)
+	go func() {
+		defer g.refreshing.Delete(key)
+		value, err := g.load(context.Background(), key)
+		if err != nil {
+			log.Println("[NeeCache] Failed to refresh", key, err)
+			return
+		}
+		populate(key, value)
+	}()
 }
 
 // 使用 PickPeer() 方法选择节点，若非本地节点，调用getFromPeer() 从远程获取，
 // 若是本机节点或失败，则回退到 getLocally
-func (g *Group) load(key string) (value ByteView, err error) {
+func (g *Group) load(ctx context.Context, key string) (ByteView, error) {
 	// each key is only fetched once (either locally or remotely)
 	// regardless of the number of concurrent callers
-	viewi, err := g.loader.Do(key, func() (interface{}, error) {
+	return g.dedup(ctx, key, func(ctx context.Context) (ByteView, error) {
 		if g.peers != nil {
 			if peer, ok := g.peers.PickPeer(key); ok {
-				if value, err = g.getFromPeer(peer, key); err == nil {
+				value, err := g.getFromPeer(ctx, peer, key)
+				if err == nil {
+					g.Stats.PeerLoads.Add(1)
+					g.populateHotCache(key, value)
 					return value, nil
 				}
+				// 归属节点确认 key 不存在，不再回退到本地加载
+				if errors.Is(err, ErrNotFound) {
+					g.Stats.PeerLoads.Add(1)
+					g.populateNegativeCache(key)
+					return ByteView{}, err
+				}
+				g.Stats.PeerErrors.Add(1)
 				log.Println("[NeeCache] Failed to get from peer", err)
+				return g.fallback(ctx, key, peer, err)
 			}
 		}
-
-		return g.getLocally(key)
+		return g.loadFromGetter(ctx, key)
 	})
 
 	//if g.peers != nil {
@@ -126,39 +468,238 @@ func (g *Group) load(key string) (value ByteView, err error) {
 	//}
 	//// 用于定义的源数据中取
 	//return g.getLocally(key)
-	if err == nil {
-		return viewi.(ByteView), nil
+}
+
+// loadLocally 不经过远程节点，直接调用 getter 加载，同样对每个 key 去重
+func (g *Group) loadLocally(ctx context.Context, key string) (ByteView, error) {
+	return g.dedup(ctx, key, func(ctx context.Context) (ByteView, error) {
+		return g.loadFromGetter(ctx, key)
+	})
+}
+
+// dedup 使用 singleflight 保证同一个 key 同时只有一次加载
+func (g *Group) dedup(ctx context.Context, key string, fn func(ctx context.Context) (ByteView, error)) (ByteView, error) {
+	var called int32
+	viewi, err := g.loader.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+		atomic.StoreInt32(&called, 1)
+		return fn(ctx)
+	})
+	// 未执行 fn，说明复用了其他协程正在进行的加载
+	if atomic.LoadInt32(&called) == 0 {
+		g.Stats.DedupedLoads.Add(1)
+	}
+	if err != nil {
+		return ByteView{}, err
+	}
+	return viewi.(ByteView), nil
+}
+
+// loadFromGetter 调用 getter 加载并统计结果
+func (g *Group) loadFromGetter(ctx context.Context, key string) (ByteView, error) {
+	value, err := g.getLocally(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		g.Stats.LocalLoads.Add(1)
+		g.populateNegativeCache(key)
+		return ByteView{}, err
 	}
-	return
+	if err != nil {
+		g.Stats.LocalLoadErrs.Add(1)
+		return ByteView{}, err
+	}
+	g.Stats.LocalLoads.Add(1)
+	return value, nil
 }
 
-func (g *Group) getLocally(key string) (ByteView, error) {
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
 	// 从用户定义的源数据中取
-	bytes, err := g.getter.Get(key)
+	bytes, err := g.getter.Get(ctx, key)
 	if err != nil {
 		return ByteView{}, err
 	}
-	value := ByteView{b: cloneBytes(bytes)}
+	value := g.newView(bytes)
 	g.populateCache(key, value)
 	return value, nil
 }
 
 // 实现了PeerGetter接口的httpGetter 从访问远程节点，获取缓存值
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
 	req := &neecachepb.Request{
 		Group: g.name,
 		Key:   key,
 	}
+	return g.fetch(ctx, peer, req)
+}
+
+// fetch 向 peer 发送 req 并解析返回的值
+func (g *Group) fetch(ctx context.Context, peer PeerGetter, req *neecachepb.Request) (ByteView, error) {
 	res := &neecachepb.Response{}
-	err := peer.Get(req, res)
+	err := peer.Get(ctx, req, res)
 	if err != nil {
-		return ByteView{}, nil
+		return ByteView{}, err
+	}
+	return viewFromPeer(res.GetValue(), res.GetEncoding(), res.GetRawLength())
+}
+
+// defaultWriteTimeout 不带 ctx 的 Set、Remove 与 Invalidate 等待远程节点的最长时间，
+// http.DefaultClient 没有超时，卡住的节点不会让调用者一直等待
+const defaultWriteTimeout = 10 * time.Second
+
+// Set stores value for key in the cache of the peer owning the key,
+// overwriting any cached value. The value is loaded by the group`s
+// getter again once it is evicted or expired. The owner is given up after
+// defaultWriteTimeout, use SetContext for another deadline.
+func (g *Group) Set(key string, value []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultWriteTimeout)
+	defer cancel()
+	return g.SetContext(ctx, key, value)
+}
+
+// SetContext is like Set, ctx is passed to the peer owning the key.
+// 使用 pickOwner 选择归属节点，若是本机节点则直接写入本地缓存
+func (g *Group) SetContext(ctx context.Context, key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if g.peers != nil {
+		if peer, ok := g.pickOwner(key); ok {
+			req := &neecachepb.SetRequest{
+				Group: g.name,
+				Key:   key,
+				Value: value,
+			}
+			if err := peer.Set(ctx, req, &neecachepb.SetResponse{}); err != nil {
+				return err
+			}
+			// 本节点镜像的旧值已经失效
+			g.hotCache.remove(key)
+			g.negativeCache.remove(key)
+			g.addKey(key)
+			return nil
+		}
+	}
+	g.setLocally(key, value)
+	return nil
+}
+
+// Remove removes key from the cache of the peer owning the key,
+// and from the hot cache of this peer. If the key filter is a KeyRemover,
+// key is removed from the filters of both peers. The owner is given up after
+// defaultWriteTimeout, use RemoveContext for another deadline.
+func (g *Group) Remove(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultWriteTimeout)
+	defer cancel()
+	return g.RemoveContext(ctx, key)
+}
+
+// RemoveContext is like Remove, ctx is passed to the peer owning the key.
+func (g *Group) RemoveContext(ctx context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if g.peers != nil {
+		if peer, ok := g.pickOwner(key); ok {
+			req := &neecachepb.DeleteRequest{
+				Group: g.name,
+				Key:   key,
+			}
+			if err := peer.Delete(ctx, req, &neecachepb.DeleteResponse{}); err != nil {
+				return err
+			}
+			g.hotCache.remove(key)
+			g.negativeCache.remove(key)
+			g.removeKey(key)
+			return nil
+		}
+	}
+	g.deleteLocally(key)
+	return nil
+}
+
+// pickOwner 返回 key 的归属节点，PickPeer 可能为了分散负载选择其他节点，写入必须发往归属节点
+func (g *Group) pickOwner(key string) (PeerGetter, bool) {
+	if picker, ok := g.peers.(OwnerPicker); ok {
+		return picker.PickOwner(key)
+	}
+	return g.peers.PickPeer(key)
+}
+
+func (g *Group) setLocally(key string, value []byte) {
+	g.hotCache.remove(key)
+	g.negativeCache.remove(key)
+	g.addKey(key)
+	g.populateCache(key, g.newView(value))
+}
+
+// addKey 将写入的 key 加入过滤器，之后被淘汰时仍可以从数据源加载
+func (g *Group) addKey(key string) {
+	if g.keyFilter != nil {
+		g.keyFilter.Add(key)
+	}
+}
+
+// removeKey 从支持删除的过滤器中删除 key
+func (g *Group) removeKey(key string) {
+	if r, ok := g.keyFilter.(KeyRemover); ok {
+		r.Remove(key)
+	}
+}
+
+// deleteLocally removes key from all caches and from the key filter of this peer.
+func (g *Group) deleteLocally(key string) bool {
+	g.removeKey(key)
+	return g.removeLocally(key)
+}
+
+// removeLocally removes key from all caches of this peer.
+func (g *Group) removeLocally(key string) bool {
+	removed := g.mainCache.remove(key)
+	if g.hotCache.remove(key) {
+		removed = true
+	}
+	if g.negativeCache.remove(key) {
+		removed = true
 	}
-	return ByteView{
-		b: res.Value,
-	}, nil
+	return removed
 }
 
 func (g *Group) populateCache(key string, value ByteView) {
 	g.mainCache.add(key, value)
 }
+
+// populateNegativeCache 记录不存在的 key，过期时间为 negativeTTL
+func (g *Group) populateNegativeCache(key string) {
+	if g.negativeTTL <= 0 {
+		return
+	}
+	g.negativeCache.add(key, ByteView{})
+}
+
+// populateHotCache 按采样比例将远程节点返回的值镜像到 hotCache
+func (g *Group) populateHotCache(key string, value ByteView) {
+	if g.hotFraction <= 0 || g.hotCache.cacheBytes <= 0 {
+		return
+	}
+	if g.hotFraction < 1 && rand.Float64() >= g.hotFraction {
+		return
+	}
+	g.addHot(key, value)
+}
+
+// addHot 将值写入 hotCache，两者总和超过 cacheBytes 时，
+// 若 hotCache 超过 mainCache 的 1/8 则淘汰 hotCache，否则淘汰 mainCache
+func (g *Group) addHot(key string, value ByteView) {
+	g.hotCache.add(key, value)
+
+	for g.cacheBytes > 0 {
+		mainBytes := g.mainCache.bytes()
+		hotBytes := g.hotCache.bytes()
+		if mainBytes+hotBytes <= g.cacheBytes {
+			return
+		}
+		if hotBytes > mainBytes/defaultHotCacheRatio {
+			g.hotCache.removeOldest()
+		} else {
+			g.mainCache.removeOldest()
+		}
+	}
+}
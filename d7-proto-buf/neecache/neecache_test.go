@@ -1,12 +1,19 @@
 package neecache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"log"
+	"neecache/bloom"
+	"neecache/neecachepb"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestGetter(t *testing.T) {
@@ -54,6 +61,40 @@ func TestGet(t *testing.T) {
 	}
 }
 
+func TestGetTTL(t *testing.T) {
+	loads := 0
+	nee := NewGroup("ttl", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(key), nil
+	}))
+	nee.SetTTL(20 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		if view, err := nee.Get("Tom"); err != nil || view.String() != "Tom" || loads != 1 {
+			t.Fatalf("get Tom failed, loads: %d", loads)
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := nee.Get("Tom"); err != nil || loads != 2 {
+		t.Fatalf("expired Tom should be reloaded, loads: %d", loads)
+	}
+}
+
+func TestSweepExpired(t *testing.T) {
+	c := &cache{cacheBytes: 2 << 10, ttl: 10 * time.Millisecond, sweepInterval: 5 * time.Millisecond}
+	defer c.close()
+	c.add("Tom", ByteView{b: []byte("630")})
+	c.add("Jack", ByteView{b: []byte("589")})
+
+	time.Sleep(30 * time.Millisecond)
+	c.mu.Lock()
+	n := c.store.Len()
+	c.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("sweeper should remove expired entries, %d left", n)
+	}
+}
+
 func TestSplitN(t *testing.T) {
 	parts := strings.SplitN("/_neecache/test/", "/", 2)
 	for i := range parts {
@@ -66,3 +107,489 @@ func TestCrc32(t *testing.T) {
 	ieee := crc32.ChecksumIEEE([]byte("test3"))
 	fmt.Println(ieee)
 }
+
+func TestAdmission(t *testing.T) {
+	loads := make(map[string]int)
+	nee := NewGroup("admission", 1000, GetterFunc(func(key string) ([]byte, error) {
+		loads[key]++
+		return []byte("value"), nil
+	}))
+	nee.EnableAdmission()
+
+	hot := []string{"Tom", "Jack", "Sam"}
+	for i := 0; i < 5; i++ {
+		for _, k := range hot {
+			_, _ = nee.Get(k)
+		}
+	}
+	// 大量只访问一次的数据
+	for i := 0; i < 500; i++ {
+		_, _ = nee.Get(fmt.Sprintf("once%d", i))
+	}
+	for _, k := range hot {
+		_, _ = nee.Get(k)
+		if loads[k] > 2 {
+			t.Fatalf("hot key %s should stay in cache, loaded %d times", k, loads[k])
+		}
+	}
+	if admitted, rejected := nee.AdmissionStats(); rejected == 0 {
+		t.Fatalf("one-hit wonders should be rejected, admitted: %d, rejected: %d", admitted, rejected)
+	}
+}
+
+type fakePeer struct {
+	gets int
+}
+
+func (p *fakePeer) Get(_ context.Context, in *neecachepb.Request, out *neecachepb.Response) error {
+	p.gets++
+	out.Value = []byte("peer-" + in.GetKey())
+	return nil
+}
+
+func (p *fakePeer) Set(_ context.Context, in *neecachepb.SetRequest, out *neecachepb.SetResponse) error {
+	return nil
+}
+
+func (p *fakePeer) Delete(_ context.Context, in *neecachepb.DeleteRequest, out *neecachepb.DeleteResponse) error {
+	return nil
+}
+
+func (p *fakePeer) Invalidate(_ context.Context, in *neecachepb.InvalidateRequest, out *neecachepb.InvalidateResponse) error {
+	return nil
+}
+
+func (p *fakePeer) GetMulti(_ context.Context, in *neecachepb.BatchRequest, out *neecachepb.BatchResponse) error {
+	out.Results = make(map[string]*neecachepb.KeyResult)
+	for _, key := range in.GetKeys() {
+		p.gets++
+		out.Results[key] = &neecachepb.KeyResult{Value: []byte("peer-" + key)}
+	}
+	return nil
+}
+
+type fakePicker struct {
+	peer *fakePeer
+}
+
+func (p *fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	return p.peer, true
+}
+
+func TestHotCache(t *testing.T) {
+	peer := &fakePeer{}
+	nee := NewGroup("hot", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	nee.RegisterPeers(&fakePicker{peer: peer})
+	nee.SetHotCache(1<<10, 1)
+
+	for i := 0; i < 3; i++ {
+		if view, err := nee.Get("Tom"); err != nil || view.String() != "peer-Tom" {
+			t.Fatalf("get Tom from peer failed")
+		}
+	}
+	if peer.gets != 1 {
+		t.Fatalf("hot key should be fetched from peer once, got %d", peer.gets)
+	}
+	if stats := nee.CacheStats(HotCache); stats.Hits != 2 || stats.Items != 1 {
+		t.Fatalf("unexpected hot cache stats %+v", stats)
+	}
+	if stats := nee.CacheStats(MainCache); stats.Items != 0 {
+		t.Fatalf("values owned by peers should not be in main cache, %+v", stats)
+	}
+}
+
+func TestHotCacheBalance(t *testing.T) {
+	nee := NewGroup("hot-balance", 400, GetterFunc(func(key string) ([]byte, error) {
+		return make([]byte, 16), nil
+	}))
+	nee.SetHotCache(400, 1)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("main%02d", i)
+		nee.populateCache(key, ByteView{b: make([]byte, 16)})
+		nee.populateHotCache(fmt.Sprintf("hot%02d", i), ByteView{b: make([]byte, 16)})
+	}
+	main, hot := nee.CacheStats(MainCache), nee.CacheStats(HotCache)
+	if main.Bytes+hot.Bytes > 400 || hot.Bytes > main.Bytes/8 {
+		t.Fatalf("hot cache should yield to main cache, main: %d, hot: %d", main.Bytes, hot.Bytes)
+	}
+}
+
+func TestStats(t *testing.T) {
+	release := make(chan struct{})
+	nee := NewGroup("stats", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "slow" {
+			<-release
+		}
+		if v, ok := db[key]; ok || key == "slow" {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%s not exist", key)
+	}))
+
+	_, _ = nee.Get("Tom")
+	_, _ = nee.Get("Tom")
+	_, _ = nee.Get("unknown")
+
+	// 并发请求同一个 key，只有一个协程真正加载
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = nee.Get("slow")
+		}()
+	}
+	for nee.Stats.Misses.Get() < 7 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	expect := map[string]int64{
+		"Gets":          8,
+		"CacheHits":     1,
+		"Misses":        7,
+		"LocalLoads":    2,
+		"LocalLoadErrs": 1,
+		"DedupedLoads":  4,
+		"PeerLoads":     0,
+	}
+	got := map[string]int64{
+		"Gets":          nee.Stats.Gets.Get(),
+		"CacheHits":     nee.Stats.CacheHits.Get(),
+		"Misses":        nee.Stats.Misses.Get(),
+		"LocalLoads":    nee.Stats.LocalLoads.Get(),
+		"LocalLoadErrs": nee.Stats.LocalLoadErrs.Get(),
+		"DedupedLoads":  nee.Stats.DedupedLoads.Get(),
+		"PeerLoads":     nee.Stats.PeerLoads.Get(),
+	}
+	if !reflect.DeepEqual(expect, got) {
+		t.Fatalf("stats %v, expect %v", got, expect)
+	}
+	if cs := nee.CacheStats(MainCache); cs.Items != 2 || cs.Gets != 8 || cs.Hits != 1 {
+		t.Fatalf("unexpected main cache stats %+v", cs)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	loads := 0
+	nee := NewGroup("negative", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+	}))
+	for i := 0; i < 2; i++ {
+		if _, err := nee.Get("unknown"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+	if loads != 2 {
+		t.Fatalf("misses should not be cached by default, got %d loads", loads)
+	}
+
+	nee.SetNegativeTTL(time.Hour)
+	for i := 0; i < 3; i++ {
+		if _, err := nee.Get("unknown"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+	if loads != 3 || nee.Stats.NegativeHits.Get() != 2 {
+		t.Fatalf("miss should be remembered, got %d loads and %d negative hits", loads, nee.Stats.NegativeHits.Get())
+	}
+	if err := nee.Set("unknown", []byte("630")); err != nil {
+		t.Fatal(err)
+	}
+	if view, err := nee.Get("unknown"); err != nil || view.String() != "630" {
+		t.Fatalf("set should clear the remembered miss, got %v", err)
+	}
+}
+
+// countingPeer 并发安全地统计 Get 的次数，每次返回不同的值
+type countingPeer struct {
+	fakePeer
+	n int32
+}
+
+func (p *countingPeer) Get(_ context.Context, in *neecachepb.Request, out *neecachepb.Response) error {
+	out.Value = []byte(fmt.Sprintf("v%d", atomic.AddInt32(&p.n, 1)))
+	return nil
+}
+
+func TestRefreshAheadHotCache(t *testing.T) {
+	peer := &countingPeer{}
+	nee := NewGroup("refresh-ahead-hot", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	nee.RegisterPeers(&replicaPicker{owner: peer})
+	nee.SetHotCache(1<<10, 1)
+	nee.SetTTL(100 * time.Millisecond)
+	nee.SetRefreshAhead(0.5)
+
+	if view, err := nee.Get("Tom"); err != nil || view.String() != "v1" {
+		t.Fatalf("get Tom from peer failed")
+	}
+	// 刷新后只按采样比例写入 hotCache 时，之后的每次 Get 都会再次请求远程节点
+	nee.hotFraction = 1e-9
+	time.Sleep(60 * time.Millisecond)
+	nee.Get("Tom")
+	deadline := time.Now().Add(time.Second)
+	for {
+		if view, _ := nee.hotCache.get("Tom"); view.String() == "v2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("refreshed value should replace the hot cache entry")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		if view, err := nee.Get("Tom"); err != nil || view.String() != "v2" {
+			t.Fatalf("expected the refreshed value, got %q", view.String())
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadInt32(&peer.n); n != 2 {
+		t.Fatalf("expected 2 fetches from the peer, got %d", n)
+	}
+}
+
+func TestKeyFilter(t *testing.T) {
+	loads := 0
+	nee := NewGroup("key-filter", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, ErrNotFound
+	}))
+	filter := bloom.New(100, 0.01)
+	filter.AddAll([]string{"Tom", "Jack", "Sam"})
+	nee.SetKeyFilter(filter)
+
+	if view, err := nee.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("key in the filter should be loaded")
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := nee.Get("unknown"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+	if loads != 1 || nee.Stats.FilteredKeys.Get() != 3 {
+		t.Fatalf("keys not in the filter should not reach the getter, got %d loads", loads)
+	}
+	if err := nee.Set("Kate", []byte("600")); err != nil {
+		t.Fatal(err)
+	}
+	if !filter.MayContain("Kate") {
+		t.Fatalf("set should add the key to the filter")
+	}
+}
+
+func TestKeyFilterRemove(t *testing.T) {
+	nee := NewGroup("key-filter-remove", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	filter := bloom.NewCounting(100, 0.01)
+	nee.SetKeyFilter(filter)
+	if err := nee.Set("Kate", []byte("600")); err != nil {
+		t.Fatal(err)
+	}
+	if err := nee.Remove("Kate"); err != nil {
+		t.Fatal(err)
+	}
+	if filter.MayContain("Kate") {
+		t.Fatalf("remove should remove the key from a counting filter")
+	}
+	if _, err := nee.Get("Kate"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after remove, got %v", err)
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	var loads int32
+	release := make(chan struct{})
+	nee := NewGroup("refresh-ahead", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		n := atomic.AddInt32(&loads, 1)
+		if n > 1 {
+			<-release
+		}
+		return []byte(fmt.Sprintf("v%d", n)), nil
+	}))
+	nee.SetTTL(100 * time.Millisecond)
+	nee.SetRefreshAhead(0.5)
+
+	if view, err := nee.Get("Tom"); err != nil || view.String() != "v1" {
+		t.Fatalf("get Tom failed")
+	}
+	time.Sleep(60 * time.Millisecond)
+	// 后台加载完成前，所有调用者都立即得到旧值，且只触发一次加载
+	for i := 0; i < 10; i++ {
+		if view, err := nee.Get("Tom"); err != nil || view.String() != "v1" {
+			t.Fatalf("value being refreshed should be returned, got %q", view.String())
+		}
+	}
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if view, _ := nee.mainCache.get("Tom"); view.String() == "v2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Tom should be refreshed in the background")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&loads); n != 2 || nee.Stats.Refreshes.Get() != 1 {
+		t.Fatalf("expected a single refresh, got %d loads and %d refreshes", n, nee.Stats.Refreshes.Get())
+	}
+}
+
+func TestStaleIfError(t *testing.T) {
+	loads := 0
+	nee := NewGroup("stale-if-error", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		if loads > 1 {
+			return nil, fmt.Errorf("db unavailable")
+		}
+		return []byte("630"), nil
+	}))
+	nee.SetTTL(20 * time.Millisecond)
+	nee.SetStaleIfError(time.Hour)
+
+	if view, err := nee.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("get Tom failed")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if view, err := nee.Get("Tom"); err != nil || view.String() != "630" || loads != 2 {
+		t.Fatalf("stale Tom should be served when reloading fails, got %v, loads: %d", err, loads)
+	}
+	if nee.Stats.StaleHits.Get() != 1 {
+		t.Fatalf("expected 1 stale hit, got %d", nee.Stats.StaleHits.Get())
+	}
+	if _, err := nee.Get("Jack"); err == nil {
+		t.Fatalf("error should be returned without a stale value")
+	}
+}
+
+func TestGetMultiLocally(t *testing.T) {
+	var loads int32
+	nee := NewGroup("get-multi-local", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, ErrNotFound
+	}))
+	keys := []string{"Tom", "Jack", "Sam", "Tom", "unknown", ""}
+	for i := 0; i < 2; i++ {
+		results := nee.GetMulti(keys)
+		if len(results) != 5 {
+			t.Fatalf("expected 5 results, got %d", len(results))
+		}
+		for k, v := range db {
+			if res := results[k]; res.Err != nil || res.Value.String() != v {
+				t.Fatalf("get %s failed: %v", k, res.Err)
+			}
+		}
+		if !errors.Is(results["unknown"].Err, ErrNotFound) || results[""].Err == nil {
+			t.Fatalf("unknown and empty keys should fail")
+		}
+	}
+	// 第二次只有不存在的 key 需要重新加载
+	if n := atomic.LoadInt32(&loads); n != 5 {
+		t.Fatalf("expected 5 loads, got %d", n)
+	}
+}
+
+// batchDB 同时实现了 Getter 与 BatchGetter
+type batchDB struct {
+	gets, batches int32
+}
+
+func (d *batchDB) Get(key string) ([]byte, error) {
+	atomic.AddInt32(&d.gets, 1)
+	if v, ok := db[key]; ok {
+		return []byte(v), nil
+	}
+	return nil, ErrNotFound
+}
+
+func (d *batchDB) GetMulti(keys []string) (map[string][]byte, error) {
+	atomic.AddInt32(&d.batches, 1)
+	values := make(map[string][]byte)
+	for _, key := range keys {
+		if v, ok := db[key]; ok {
+			values[key] = []byte(v)
+		}
+	}
+	return values, nil
+}
+
+func TestBatchGetter(t *testing.T) {
+	source := &batchDB{}
+	nee := NewGroup("batch-getter", 2<<10, source)
+	results := nee.GetMulti([]string{"Tom", "Jack", "Sam", "unknown"})
+	for k, v := range db {
+		if res := results[k]; res.Err != nil || res.Value.String() != v {
+			t.Fatalf("get %s failed: %v", k, res.Err)
+		}
+	}
+	if !errors.Is(results["unknown"].Err, ErrNotFound) {
+		t.Fatalf("key missing from the batch should be not found, got %v", results["unknown"].Err)
+	}
+	if source.batches != 1 || source.gets != 0 {
+		t.Fatalf("misses should be loaded in one batch, got %d batches and %d gets", source.batches, source.gets)
+	}
+	if view, err := nee.Get("Tom"); err != nil || view.String() != "630" || source.gets != 0 {
+		t.Fatalf("batch loaded values should be cached")
+	}
+}
+
+func TestGetterPanic(t *testing.T) {
+	nee, _ := NewRegistry().NewGroup("getter-panic", GetterFunc(func(key string) ([]byte, error) {
+		panic("boom")
+	}))
+	// getter 的 panic 在调用者的协程中抛出，可以被调用者恢复
+	func() {
+		defer func() {
+			if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "boom") {
+				t.Fatalf("expected the panic of the getter, got %v", r)
+			}
+		}()
+		nee.Get("Tom")
+	}()
+}
+
+func TestLoadConcurrency(t *testing.T) {
+	var running, max int32
+	nee, err := NewRegistry().NewGroupCtx("load-concurrency", GetterCtxFunc(func(_ context.Context, key string) ([]byte, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return []byte(key), nil
+	}), WithLoadConcurrency(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 50)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+	results := nee.GetMulti(keys)
+	for _, key := range keys {
+		if res := results[key]; res.Err != nil || res.Value.String() != key {
+			t.Fatalf("get %s failed: %v", key, res.Err)
+		}
+	}
+	if m := atomic.LoadInt32(&max); m > 4 || m < 2 {
+		t.Fatalf("expected at most 4 concurrent loads, got %d", m)
+	}
+}
@@ -0,0 +1,158 @@
+package neecache
+
+import (
+	"time"
+)
+
+// An Option configures a Group created by NewGroupWithOptions.
+type Option func(o *options)
+
+// options 创建 Group 时的配置，零值与 NewGroup 的默认行为一致
+type options struct {
+	cacheBytes        int64
+	policy            EvictionPolicy
+	shards            int
+	ttl               time.Duration
+	admission         bool
+	hotCacheBytes     int64 // 小于零时使用 cacheBytes/defaultHotCacheRatio
+	hotFraction       float64
+	negativeTTL       time.Duration
+	keyFilter         KeyFilter
+	refreshAhead      float64
+	maxStale          time.Duration
+	compressor        Compressor
+	compressThreshold int
+	fallbackPolicy    FallbackPolicy
+	loadConcurrency   int
+	peers             PeerPicker
+	onEvicted         func(key string, value ByteView)
+}
+
+func defaultOptions() *options {
+	return &options{
+		shards:        1,
+		hotCacheBytes: -1,
+		hotFraction:   defaultHotFraction,
+	}
+}
+
+// WithCacheBytes limits the bytes used by the caches of the group.
+// Without it the caches are not limited.
+func WithCacheBytes(cacheBytes int64) Option {
+	return func(o *options) {
+		o.cacheBytes = cacheBytes
+	}
+}
+
+// WithPolicy sets the eviction policy of the cache, PolicyLRU by default.
+func WithPolicy(policy EvictionPolicy) Option {
+	return func(o *options) {
+		o.policy = policy
+	}
+}
+
+// WithShards splits the cache into n shards, see Group.SetShards.
+func WithShards(n int) Option {
+	return func(o *options) {
+		o.shards = n
+	}
+}
+
+// WithTTL sets the default time to live of values, see Group.SetTTL.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithAdmission enables the W-TinyLFU admission filter, see Group.EnableAdmission.
+func WithAdmission() Option {
+	return func(o *options) {
+		o.admission = true
+	}
+}
+
+// WithHotCache sets the size of the hot cache and the fraction of values
+// fetched from peers mirrored into it, see Group.SetHotCache.
+func WithHotCache(cacheBytes int64, fraction float64) Option {
+	return func(o *options) {
+		o.hotCacheBytes = cacheBytes
+		o.hotFraction = fraction
+	}
+}
+
+// WithNegativeTTL enables negative caching, see Group.SetNegativeTTL.
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.negativeTTL = ttl
+	}
+}
+
+// WithKeyFilter sets the filter of known keys, see Group.SetKeyFilter.
+func WithKeyFilter(f KeyFilter) Option {
+	return func(o *options) {
+		o.keyFilter = f
+	}
+}
+
+// WithRefreshAhead enables refresh-ahead, see Group.SetRefreshAhead.
+func WithRefreshAhead(fraction float64) Option {
+	return func(o *options) {
+		o.refreshAhead = fraction
+	}
+}
+
+// WithStaleIfError enables stale-if-error, see Group.SetStaleIfError.
+func WithStaleIfError(maxStale time.Duration) Option {
+	return func(o *options) {
+		o.maxStale = maxStale
+	}
+}
+
+// WithCompression compresses values of at least threshold bytes with c,
+// see Group.SetCompression.
+func WithCompression(c Compressor, threshold int) Option {
+	return func(o *options) {
+		o.compressor = c
+		o.compressThreshold = threshold
+	}
+}
+
+// WithFallbackPolicy sets what the group does when the peer owning a key
+// fails, see Group.SetFallbackPolicy.
+func WithFallbackPolicy(policy FallbackPolicy) Option {
+	return func(o *options) {
+		o.fallbackPolicy = policy
+	}
+}
+
+// WithLoadConcurrency limits the keys of one GetMulti loaded concurrently by
+// the getter, see Group.SetLoadConcurrency.
+func WithLoadConcurrency(n int) Option {
+	return func(o *options) {
+		o.loadConcurrency = n
+	}
+}
+
+// WithPeers registers the PeerPicker of the group, see Group.RegisterPeers.
+func WithPeers(peers PeerPicker) Option {
+	return func(o *options) {
+		o.peers = peers
+	}
+}
+
+// WithOnEvicted sets a hook called when a value is evicted from the main cache
+// because it is full or the value expired. It is called with the cache locked
+// and must not call back into the group.
+func WithOnEvicted(fn func(key string, value ByteView)) Option {
+	return func(o *options) {
+		o.onEvicted = fn
+	}
+}
+
+// NewGroupWithOptions creates a group in the default registry, it fails if a
+// group with the same name exists.
+// 未指定的配置与 NewGroup 相同，cacheBytes 默认为 0，即不限制内存
+func NewGroupWithOptions(name string, getter Getter, opts ...Option) (*Group, error) {
+	return DefaultRegistry.NewGroup(name, getter, opts...)
+}
@@ -1,6 +1,9 @@
 package neecache
 
-import "neecache/neecachepb"
+import (
+	"context"
+	"neecache/neecachepb"
+)
 
 // PeerPicker is the interface that must be implemented to locate
 // the peer that owns a specific key.
@@ -13,5 +16,36 @@ type PeerPicker interface {
 type PeerGetter interface {
 	// 用于从对应group查找缓存值，PeerGroup就对应上述流程中的Http客户端
 	//Get(group string, key string) ([]byte, error)
-	Get(in *neecachepb.Request, out *neecachepb.Response) error
+	// ctx 的取消与截止时间会随请求传递给远程节点
+	Get(ctx context.Context, in *neecachepb.Request, out *neecachepb.Response) error
+	// Set 将值写入该节点的缓存，Delete 从该节点的缓存中删除
+	Set(ctx context.Context, in *neecachepb.SetRequest, out *neecachepb.SetResponse) error
+	Delete(ctx context.Context, in *neecachepb.DeleteRequest, out *neecachepb.DeleteResponse) error
+	// Invalidate 从该节点的所有缓存中删除，不论该节点是否是归属节点
+	Invalidate(ctx context.Context, in *neecachepb.InvalidateRequest, out *neecachepb.InvalidateResponse) error
+	// GetMulti 在一次请求中查找该节点负责的多个 key
+	GetMulti(ctx context.Context, in *neecachepb.BatchRequest, out *neecachepb.BatchResponse) error
+}
+
+// A ReplicaPicker is a PeerPicker which also knows the next owner of a key,
+// it is used by FallbackNextReplica.
+type ReplicaPicker interface {
+	// PickReplica returns the peer owning key after failed. ok is false if
+	// this node is the next owner, or there is no other node.
+	PickReplica(key string, failed PeerGetter) (peer PeerGetter, ok bool)
+}
+
+// An OwnerPicker is a PeerPicker which may pick another peer than the owner
+// of a key to spread the load, e.g. with bounded loads. Set and Remove use
+// PickOwner, so that writes always reach the owner.
+type OwnerPicker interface {
+	// PickOwner returns the peer owning key, ok is false if this node owns it.
+	PickOwner(key string) (peer PeerGetter, ok bool)
+}
+
+// PeerLister is implemented by a PeerPicker which knows all the peers,
+// it is used to broadcast invalidations.
+type PeerLister interface {
+	// ListPeers returns all peers except this one, keyed by their address.
+	ListPeers() map[string]PeerGetter
 }
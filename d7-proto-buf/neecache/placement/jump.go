@@ -0,0 +1,117 @@
+package placement
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Jump implements Jump consistent hash (Lamping and Veach), it needs no memory
+// besides the list of buckets and is evenly balanced, but buckets are numbered:
+// nodes are numbered in the order of their names, a node with weight w takes w
+// consecutive buckets. Only about 1/N of the keys move when the added or
+// removed node sorts last, e.g. nodes named "cache-01", "cache-02", and so on,
+// any other change moves the keys of the buckets after it.
+// 节点按名称排序，所有节点无论成员变更的顺序如何都得到相同的结果
+type Jump struct {
+	mu      sync.Mutex   // 串行化成员变更
+	nodes   []node       // guarded by mu
+	buckets atomic.Value // []string，第 i 个桶所属的节点
+}
+
+// NewJump creates an empty Jump.
+func NewJump() *Jump {
+	j := &Jump{}
+	j.buckets.Store([]string(nil))
+	return j
+}
+
+func (j *Jump) load() []string {
+	return j.buckets.Load().([]string)
+}
+
+// Add implements Placement.
+func (j *Jump) Add(nodes ...string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.update(nil, weights(j.nodes, nodes))
+}
+
+// AddWeighted implements Placement.
+func (j *Jump) AddWeighted(node string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.update(nil, map[string]int{node: weight})
+}
+
+// Remove implements Placement.
+func (j *Jump) Remove(nodes ...string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.update(nodes, nil)
+}
+
+// j.mu must be held.
+func (j *Jump) update(remove []string, add map[string]int) {
+	nodes, changed := update(j.nodes, remove, add)
+	if !changed {
+		return
+	}
+	j.nodes = nodes
+	var buckets []string
+	for _, n := range nodes {
+		for i := 0; i < n.weight; i++ {
+			buckets = append(buckets, n.name)
+		}
+	}
+	j.buckets.Store(buckets)
+}
+
+// jumpHash returns the bucket in [0, buckets) of key.
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// Get implements Placement.
+func (j *Jump) Get(key string) string {
+	buckets := j.load()
+	if len(buckets) == 0 {
+		return ""
+	}
+	return buckets[jumpHash(hash64(key), len(buckets))]
+}
+
+// GetN implements Placement. The other nodes are picked by hashing key with a
+// salt, so that the keys of a node are spread over the others.
+func (j *Jump) GetN(key string, n int) []string {
+	buckets := j.load()
+	if len(buckets) == 0 || n <= 0 {
+		return nil
+	}
+	names := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	pick := func(name string) {
+		if len(names) < n && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	pick(buckets[jumpHash(hash64(key), len(buckets))])
+	for i := 1; len(names) < n && i <= 4*len(buckets); i++ {
+		pick(buckets[jumpHash(hash64(strconv.Itoa(i)+key), len(buckets))])
+	}
+	// 尝试次数用尽后按桶的顺序补齐
+	for _, name := range buckets {
+		pick(name)
+	}
+	return names
+}
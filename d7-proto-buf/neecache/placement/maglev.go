@@ -0,0 +1,159 @@
+package placement
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultMaglevSize is the size of the lookup table of NewMaglev(0), it should
+// be prime and much larger than the number of nodes.
+const DefaultMaglevSize = 65537
+
+// Maglev implements Maglev hashing (Eisenbud et al.): every node fills the
+// entries of a lookup table in the order of its own permutation, Get is a
+// single table lookup. Nodes own almost the same number of entries, and a
+// membership change moves slightly more keys than the minimum.
+// 查找表在每次成员变更时重建，耗时与表的大小成正比
+type Maglev struct {
+	mu    sync.Mutex   // 串行化成员变更
+	size  int          // 查找表的大小，为质数
+	nodes []node       // guarded by mu
+	table atomic.Value // []string，查找表
+}
+
+// NewMaglev creates an empty Maglev with a lookup table of size entries,
+// rounded up to a prime. A size of 0 means DefaultMaglevSize.
+func NewMaglev(size int) *Maglev {
+	if size <= 0 {
+		size = DefaultMaglevSize
+	}
+	for !isPrime(size) {
+		size++
+	}
+	m := &Maglev{size: size}
+	m.table.Store([]string(nil))
+	return m
+}
+
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for i := 2; i*i <= n; i++ {
+		if n%i == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Maglev) load() []string {
+	return m.table.Load().([]string)
+}
+
+// Add implements Placement.
+func (m *Maglev) Add(nodes ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.update(nil, weights(m.nodes, nodes))
+}
+
+// AddWeighted implements Placement.
+func (m *Maglev) AddWeighted(node string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.update(nil, map[string]int{node: weight})
+}
+
+// Remove implements Placement.
+func (m *Maglev) Remove(nodes ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.update(nodes, nil)
+}
+
+// m.mu must be held.
+func (m *Maglev) update(remove []string, add map[string]int) {
+	nodes, changed := update(m.nodes, remove, add)
+	if !changed {
+		return
+	}
+	m.nodes = nodes
+	m.table.Store(m.populate())
+}
+
+// populate 轮流让每个节点按自己的排列 (offset + j·skip) mod size 占据第一个空位，
+// 权重为 w 的节点每轮占据 w 个位置
+// m.mu must be held.
+func (m *Maglev) populate() []string {
+	if len(m.nodes) == 0 {
+		return nil
+	}
+	size := uint64(m.size)
+	offset := make([]uint64, len(m.nodes))
+	skip := make([]uint64, len(m.nodes))
+	next := make([]uint64, len(m.nodes))
+	for i, n := range m.nodes {
+		h := hash64(n.name)
+		offset[i] = h % size
+		skip[i] = fmix64(h)%(size-1) + 1
+	}
+	entry := make([]int, m.size)
+	for i := range entry {
+		entry[i] = -1
+	}
+	filled := 0
+	for {
+		for i, n := range m.nodes {
+			for w := 0; w < n.weight; w++ {
+				c := (offset[i] + next[i]*skip[i]) % size
+				for entry[c] >= 0 {
+					next[i]++
+					c = (offset[i] + next[i]*skip[i]) % size
+				}
+				entry[c] = i
+				next[i]++
+				filled++
+				if filled == m.size {
+					table := make([]string, m.size)
+					for j, e := range entry {
+						table[j] = m.nodes[e].name
+					}
+					return table
+				}
+			}
+		}
+	}
+}
+
+// Get implements Placement.
+func (m *Maglev) Get(key string) string {
+	table := m.load()
+	if len(table) == 0 {
+		return ""
+	}
+	return table[hash64(key)%uint64(len(table))]
+}
+
+// GetN implements Placement, the other nodes are the next distinct entries
+// of the lookup table.
+func (m *Maglev) GetN(key string, n int) []string {
+	table := m.load()
+	if len(table) == 0 || n <= 0 {
+		return nil
+	}
+	idx := hash64(key) % uint64(len(table))
+	names := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; i < len(table) && len(names) < n; i++ {
+		name := table[(idx+uint64(i))%uint64(len(table))]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
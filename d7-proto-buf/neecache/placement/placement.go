@@ -0,0 +1,111 @@
+// Package placement decides which node owns a key.
+// 除了 consistenthash 的哈希环，还提供 rendezvous(HRW)、Jump 与 Maglev 三种算法，
+// 所有实现都在变更成员时复制并原子地替换快照，查找不需要加锁
+package placement
+
+import (
+	"hash/fnv"
+	"neecache/consistenthash"
+)
+
+// A Placement maps keys to nodes. All peers must use the same Placement with
+// the same nodes and weights to agree on the owner of a key.
+// It must be safe for concurrent use.
+type Placement interface {
+	// Add adds nodes with weight 1, nodes already added are ignored.
+	Add(nodes ...string)
+	// AddWeighted adds node with weight, or changes the weight of node.
+	// A node with weight w owns about w times the keys of a node with weight 1.
+	AddWeighted(node string, weight int)
+	// Remove removes nodes, nodes not added are ignored.
+	Remove(nodes ...string)
+	// Get returns the node owning key, or "" if there is no node.
+	Get(key string) string
+	// GetN returns up to n distinct nodes for key in order of preference,
+	// the first one is the node returned by Get.
+	GetN(key string, n int) []string
+}
+
+var (
+	_ Placement = (*consistenthash.Map)(nil)
+	_ Placement = (*Rendezvous)(nil)
+	_ Placement = (*Jump)(nil)
+	_ Placement = (*Maglev)(nil)
+)
+
+// hash64 使用 FNV-1a 计算 64 位哈希值，再经过 fmix64 使各比特分布均匀
+func hash64(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return fmix64(h.Sum64())
+}
+
+// fmix64 is the finalizer of MurmurHash3.
+func fmix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// node is a node with its weight, snapshots keep nodes sorted by name so that
+// every peer builds the same snapshot whatever the order of the changes.
+type node struct {
+	name   string
+	weight int
+}
+
+// update 返回 nodes 删除 remove、加入或修改 add 后按名称排序的副本，changed 表示是否有变化
+func update(nodes []node, remove []string, add map[string]int) (updated []node, changed bool) {
+	removed := make(map[string]bool, len(remove))
+	for _, name := range remove {
+		removed[name] = true
+	}
+	updated = make([]node, 0, len(nodes)+len(add))
+	for _, n := range nodes {
+		if removed[n.name] {
+			changed = true
+			continue
+		}
+		if w, ok := add[n.name]; ok {
+			if w != n.weight {
+				changed = true
+				n.weight = w
+			}
+			delete(add, n.name)
+		}
+		updated = append(updated, n)
+	}
+	for name, w := range add {
+		changed = true
+		updated = append(updated, node{name: name, weight: w})
+	}
+	sortNodes(updated)
+	return updated, changed
+}
+
+func sortNodes(nodes []node) {
+	// 节点数较少，插入排序即可
+	for i := 1; i < len(nodes); i++ {
+		for j := i; j > 0 && nodes[j].name < nodes[j-1].name; j-- {
+			nodes[j], nodes[j-1] = nodes[j-1], nodes[j]
+		}
+	}
+}
+
+// weights 返回 Add 使用的权重，已存在的节点不修改
+func weights(nodes []node, names []string) map[string]int {
+	exists := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		exists[n.name] = true
+	}
+	add := make(map[string]int, len(names))
+	for _, name := range names {
+		if !exists[name] {
+			add[name] = 1
+		}
+	}
+	return add
+}
@@ -0,0 +1,250 @@
+package placement
+
+import (
+	"fmt"
+	"math"
+	"neecache/consistenthash"
+	"strconv"
+	"testing"
+)
+
+var placements = []struct {
+	name string
+	new  func() Placement
+}{
+	{"ring", func() Placement { return consistenthash.New(50, nil) }},
+	{"rendezvous", func() Placement { return NewRendezvous() }},
+	{"jump", func() Placement { return NewJump() }},
+	{"maglev", func() Placement { return NewMaglev(0) }},
+}
+
+// nodeName 返回按编号排序的节点名称，Jump 在最后加入节点时只移动约 1/N 的 key
+func nodeName(i int) string {
+	return fmt.Sprintf("http://10.0.0.%03d:8001", i)
+}
+
+func owners(p Placement, keys int) []string {
+	owners := make([]string, keys)
+	for i := range owners {
+		owners[i] = p.Get("key" + strconv.Itoa(i))
+	}
+	return owners
+}
+
+// skew 返回节点拥有的 key 数相对平均值的最大偏差
+func skew(owners []string, nodes int) float64 {
+	counts := make(map[string]int)
+	for _, owner := range owners {
+		counts[owner]++
+	}
+	mean := float64(len(owners)) / float64(nodes)
+	max := 0.0
+	for _, count := range counts {
+		max = math.Max(max, math.Abs(float64(count)-mean)/mean)
+	}
+	return max
+}
+
+func movedRatio(before, after []string) float64 {
+	moved := 0
+	for i := range before {
+		if before[i] != after[i] {
+			moved++
+		}
+	}
+	return float64(moved) / float64(len(before))
+}
+
+func TestPlacement(t *testing.T) {
+	for _, tt := range placements {
+		p := tt.new()
+		if p.Get("Tom") != "" || p.GetN("Tom", 3) != nil {
+			t.Fatalf("%s: empty placement should yield nothing", tt.name)
+		}
+		p.Add(nodeName(1), nodeName(2), nodeName(3))
+		p.Add(nodeName(1))
+		for _, key := range []string{"Tom", "Jack", "Sam"} {
+			nodes := p.GetN(key, 5)
+			if len(nodes) != 3 || nodes[0] != p.Get(key) {
+				t.Fatalf("%s: GetN(%s) should start with Get and hold every node once, got %v", tt.name, key, nodes)
+			}
+			seen := make(map[string]bool)
+			for _, n := range nodes {
+				if seen[n] {
+					t.Fatalf("%s: GetN(%s) returned %s twice", tt.name, key, n)
+				}
+				seen[n] = true
+			}
+		}
+		p.Remove(nodeName(2), nodeName(4))
+		for _, owner := range owners(p, 1000) {
+			if owner != nodeName(1) && owner != nodeName(3) {
+				t.Fatalf("%s: removed node %s still owns keys", tt.name, owner)
+			}
+		}
+	}
+}
+
+func TestPlacementBalance(t *testing.T) {
+	const nodes, keys = 10, 100000
+	for _, tt := range placements {
+		p := tt.new()
+		for i := 0; i < nodes; i++ {
+			p.Add(nodeName(i))
+		}
+		s := skew(owners(p, keys), nodes)
+		t.Logf("%s: max skew %.1f%%", tt.name, 100*s)
+		// 虚拟节点为 50 的哈希环偏差最大，其余算法应明显更均衡
+		if tt.name != "ring" && s > 0.05 {
+			t.Errorf("%s: expected less than 5%% skew, got %.1f%%", tt.name, 100*s)
+		}
+	}
+}
+
+func TestPlacementMovement(t *testing.T) {
+	const nodes, keys = 10, 100000
+	for _, tt := range placements {
+		p := tt.new()
+		for i := 0; i < nodes; i++ {
+			p.Add(nodeName(i))
+		}
+		before := owners(p, keys)
+		// 新节点的名称排在最后
+		p.Add(nodeName(nodes))
+		after := owners(p, keys)
+		for i := range before {
+			// Maglev 重建查找表时少量 key 会在原有节点之间移动
+			if before[i] != after[i] && after[i] != nodeName(nodes) && tt.name != "maglev" {
+				t.Fatalf("%s: key%d moved between old nodes", tt.name, i)
+			}
+		}
+		ratio := movedRatio(before, after)
+		t.Logf("%s: %.1f%% of keys moved", tt.name, 100*ratio)
+		if ratio > 1.5/(nodes+1) {
+			t.Errorf("%s: expected about 1/%d of keys to move, got %.3f", tt.name, nodes+1, ratio)
+		}
+
+		// 删除名称排在中间的节点
+		p.Remove(nodeName(3))
+		removed := owners(p, keys)
+		for i := range after {
+			if after[i] != removed[i] && after[i] != nodeName(3) && tt.name != "maglev" && tt.name != "jump" {
+				t.Fatalf("%s: key%d moved between remaining nodes", tt.name, i)
+			}
+		}
+		ratio = movedRatio(after, removed)
+		t.Logf("%s: %.1f%% of keys moved after removing a middle node", tt.name, 100*ratio)
+		switch {
+		case tt.name == "jump" && ratio < 3.0/(nodes+1):
+			// Jump 按名称给桶编号，其后的桶都会重新编号
+			t.Errorf("%s: expected most keys after the removed node to move, got %.3f", tt.name, ratio)
+		case tt.name != "jump" && ratio > 1.5/(nodes+1):
+			t.Errorf("%s: expected about 1/%d of keys to move, got %.3f", tt.name, nodes+1, ratio)
+		}
+	}
+}
+
+func TestPlacementWeights(t *testing.T) {
+	const keys = 100000
+	for _, tt := range placements {
+		if tt.name == "ring" {
+			// 哈希环的权重由 consistenthash 测试
+			continue
+		}
+		p := tt.new()
+		p.AddWeighted(nodeName(1), 1)
+		p.AddWeighted(nodeName(2), 3)
+		counts := make(map[string]int)
+		for _, owner := range owners(p, keys) {
+			counts[owner]++
+		}
+		if ratio := float64(counts[nodeName(2)]) / float64(counts[nodeName(1)]); ratio < 2.7 || ratio > 3.3 {
+			t.Errorf("%s: expected weight 3 to own 3 times the keys, got %.2f", tt.name, ratio)
+		}
+		p.AddWeighted(nodeName(2), 1)
+		if ratio := float64(countOf(owners(p, keys), nodeName(2))) / (keys / 2); ratio < 0.9 || ratio > 1.1 {
+			t.Errorf("%s: expected equal weights to own the same keys, got %.2f", tt.name, ratio)
+		}
+	}
+}
+
+func countOf(owners []string, node string) int {
+	n := 0
+	for _, owner := range owners {
+		if owner == node {
+			n++
+		}
+	}
+	return n
+}
+
+// BenchmarkGet compares the cost of a lookup with 10 and 100 nodes.
+func BenchmarkGet(b *testing.B) {
+	for _, nodes := range []int{10, 100} {
+		for _, tt := range placements {
+			p := tt.new()
+			for i := 0; i < nodes; i++ {
+				p.Add(nodeName(i))
+			}
+			keys := make([]string, 1024)
+			for i := range keys {
+				keys[i] = "key" + strconv.Itoa(i)
+			}
+			b.Run(fmt.Sprintf("%s/%d", tt.name, nodes), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					p.Get(keys[i%len(keys)])
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkBalance reports the max skew of the keys owned by 10 nodes.
+func BenchmarkBalance(b *testing.B) {
+	const nodes, keys = 10, 100000
+	for _, tt := range placements {
+		b.Run(tt.name, func(b *testing.B) {
+			var s float64
+			for i := 0; i < b.N; i++ {
+				p := tt.new()
+				for j := 0; j < nodes; j++ {
+					p.Add(nodeName(j))
+				}
+				s = skew(owners(p, keys), nodes)
+			}
+			b.ReportMetric(100*s, "skew%")
+		})
+	}
+}
+
+// BenchmarkMovement reports the keys moved when an eleventh node joins last,
+// when it joins between the fourth and fifth node and when the fourth node of
+// 10 leaves, the minimum is about 9%, 9% and 10%. Jump moves most keys after
+// the node in the middle.
+func BenchmarkMovement(b *testing.B) {
+	const nodes, keys = 10, 100000
+	for _, tt := range placements {
+		b.Run(tt.name, func(b *testing.B) {
+			var added, inserted, removed float64
+			for i := 0; i < b.N; i++ {
+				p := tt.new()
+				for j := 0; j < nodes; j++ {
+					p.Add(nodeName(j))
+				}
+				before := owners(p, keys)
+				p.Add(nodeName(nodes))
+				added = movedRatio(before, owners(p, keys))
+				p.Remove(nodeName(nodes))
+				// 名称排在第 4 与第 5 个节点之间
+				p.Add(nodeName(3) + "0")
+				inserted = movedRatio(before, owners(p, keys))
+				p.Remove(nodeName(3) + "0")
+				p.Remove(nodeName(3))
+				removed = movedRatio(before, owners(p, keys))
+			}
+			b.ReportMetric(100*added, "added-moved%")
+			b.ReportMetric(100*inserted, "inserted-moved%")
+			b.ReportMetric(100*removed, "removed-moved%")
+		})
+	}
+}
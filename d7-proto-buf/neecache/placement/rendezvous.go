@@ -0,0 +1,130 @@
+package placement
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Rendezvous implements highest random weight hashing: every node scores
+// every key and the node with the highest score owns it. Adding or removing a
+// node only moves the keys it owns, and the balance does not depend on virtual
+// nodes, but Get costs O(N) in the number of nodes.
+// 带权重时使用 -w/ln(u) 作为分数(weighted rendezvous hashing)
+type Rendezvous struct {
+	mu    sync.Mutex   // 串行化成员变更
+	nodes atomic.Value // []rendezvousNode
+}
+
+type rendezvousNode struct {
+	node
+	seed uint64 // 节点名称的哈希值
+}
+
+// NewRendezvous creates an empty Rendezvous.
+func NewRendezvous() *Rendezvous {
+	r := &Rendezvous{}
+	r.nodes.Store([]rendezvousNode(nil))
+	return r
+}
+
+func (r *Rendezvous) load() []rendezvousNode {
+	return r.nodes.Load().([]rendezvousNode)
+}
+
+// Add implements Placement.
+func (r *Rendezvous) Add(nodes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.update(nil, weights(r.list(), nodes))
+}
+
+// AddWeighted implements Placement.
+func (r *Rendezvous) AddWeighted(node string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.update(nil, map[string]int{node: weight})
+}
+
+// Remove implements Placement.
+func (r *Rendezvous) Remove(nodes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.update(nodes, nil)
+}
+
+// list returns the nodes of the snapshot.
+// r.mu must be held.
+func (r *Rendezvous) list() []node {
+	current := r.load()
+	nodes := make([]node, len(current))
+	for i, n := range current {
+		nodes[i] = n.node
+	}
+	return nodes
+}
+
+// r.mu must be held.
+func (r *Rendezvous) update(remove []string, add map[string]int) {
+	nodes, changed := update(r.list(), remove, add)
+	if !changed {
+		return
+	}
+	snapshot := make([]rendezvousNode, len(nodes))
+	for i, n := range nodes {
+		snapshot[i] = rendezvousNode{node: n, seed: hash64(n.name)}
+	}
+	r.nodes.Store(snapshot)
+}
+
+// score 计算节点对 key 的分数，权重相同时等价于比较哈希值
+func (n *rendezvousNode) score(key uint64) float64 {
+	h := fmix64(key ^ n.seed)
+	// 取高 53 位映射到 (0, 1)
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+	return -float64(n.weight) / math.Log(u)
+}
+
+// Get implements Placement.
+func (r *Rendezvous) Get(key string) string {
+	nodes := r.load()
+	if len(nodes) == 0 {
+		return ""
+	}
+	h := hash64(key)
+	best, bestScore := 0, nodes[0].score(h)
+	for i := 1; i < len(nodes); i++ {
+		if s := nodes[i].score(h); s > bestScore {
+			best, bestScore = i, s
+		}
+	}
+	return nodes[best].name
+}
+
+// GetN implements Placement, nodes are ordered by their scores.
+func (r *Rendezvous) GetN(key string, n int) []string {
+	nodes := r.load()
+	if len(nodes) == 0 || n <= 0 {
+		return nil
+	}
+	h := hash64(key)
+	scores := make([]float64, len(nodes))
+	order := make([]int, len(nodes))
+	for i := range nodes {
+		scores[i] = nodes[i].score(h)
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	if n > len(nodes) {
+		n = len(nodes)
+	}
+	names := make([]string, n)
+	for i := range names {
+		names[i] = nodes[order[i]].name
+	}
+	return names
+}
@@ -0,0 +1,76 @@
+package neecache
+
+import (
+	"fmt"
+	"neecache/arc"
+	"neecache/lfu"
+	"neecache/lru"
+	"neecache/twoq"
+	"time"
+)
+
+// Policy is the eviction algorithm behind a cache.
+// It is not safe for concurrent access, cache guards it with a mutex.
+type Policy interface {
+	Get(key string) (value lru.Value, ok bool)
+	// Contains reports whether key is cached without counting it as an access.
+	Contains(key string) bool
+	AddWithExpire(key string, value lru.Value, expire time.Time)
+	Remove(key string) bool
+	// Victim returns the key that would be evicted next.
+	Victim() (key string, ok bool)
+	RemoveOldest()
+	RemoveExpired() int
+	Len() int
+	Bytes() int64
+}
+
+var (
+	_ Policy = (*lru.Cache)(nil)
+	_ Policy = (*lfu.Cache)(nil)
+	_ Policy = (*arc.Cache)(nil)
+	_ Policy = (*twoq.Cache)(nil)
+)
+
+// EvictionPolicy selects the Policy used by the cache of a Group.
+type EvictionPolicy int
+
+const (
+	// PolicyLRU 淘汰最近最少访问的数据，默认策略
+	PolicyLRU EvictionPolicy = iota
+	// PolicyLFU 淘汰访问频次最低的数据
+	PolicyLFU
+	// PolicyARC 自适应地在最近访问与访问频次之间取舍，能抵抗扫描
+	PolicyARC
+	// Policy2Q 只有再次访问的数据才进入主缓存，能抵抗扫描
+	Policy2Q
+)
+
+func (p EvictionPolicy) String() string {
+	switch p {
+	case PolicyLRU:
+		return "lru"
+	case PolicyLFU:
+		return "lfu"
+	case PolicyARC:
+		return "arc"
+	case Policy2Q:
+		return "2q"
+	}
+	return fmt.Sprintf("EvictionPolicy(%d)", int(p))
+}
+
+// newPolicy creates the Policy selected by p.
+func newPolicy(p EvictionPolicy, maxBytes int64, onEvicted func(string, lru.Value, lru.EvictReason)) Policy {
+	switch p {
+	case PolicyLRU:
+		return lru.New(maxBytes, onEvicted)
+	case PolicyLFU:
+		return lfu.New(maxBytes, onEvicted)
+	case PolicyARC:
+		return arc.New(maxBytes, onEvicted)
+	case Policy2Q:
+		return twoq.New(maxBytes, onEvicted)
+	}
+	panic("neecache: unknown eviction policy " + p.String())
+}
@@ -0,0 +1,183 @@
+package neecache
+
+import (
+	"fmt"
+	"math/rand"
+	"neecache/lru"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var policies = []EvictionPolicy{PolicyLRU, PolicyLFU, PolicyARC, Policy2Q}
+
+func TestGroupPolicy(t *testing.T) {
+	for _, p := range policies {
+		loads := 0
+		nee := NewGroupWithPolicy("policy-"+p.String(), 2<<10, p, GetterFunc(func(key string) ([]byte, error) {
+			loads++
+			return []byte(key), nil
+		}))
+		for i := 0; i < 2; i++ {
+			if view, err := nee.Get("Tom"); err != nil || view.String() != "Tom" || loads != 1 {
+				t.Fatalf("%s: get Tom failed, loads: %d", p, loads)
+			}
+		}
+	}
+}
+
+func bytesView(s string) ByteView {
+	return ByteView{b: []byte(s)}
+}
+
+// TestPolicyBehavior 每种淘汰策略都要通过的通用行为测试
+func TestPolicyBehavior(t *testing.T) {
+	for _, p := range policies {
+		c := newPolicy(p, 0, nil)
+		c.AddWithExpire("key1", bytesView("1234"), time.Time{})
+		if v, ok := c.Get("key1"); !ok || v.(ByteView).String() != "1234" {
+			t.Fatalf("%s: cache hit key1=1234 failed", p)
+		}
+		if _, ok := c.Get("key2"); ok {
+			t.Fatalf("%s: cache miss key2 failed", p)
+		}
+		c.AddWithExpire("key1", bytesView("5678"), time.Time{})
+		if v, ok := c.Get("key1"); !ok || v.(ByteView).String() != "5678" || c.Len() != 1 || c.Bytes() != 8 {
+			t.Fatalf("%s: update key1 failed", p)
+		}
+
+		// 容量不超过 maxBytes，Victim 与 RemoveOldest 淘汰同一个 key
+		var evicted []string
+		c = newPolicy(p, 10, func(key string, value lru.Value, reason lru.EvictReason) {
+			if reason != lru.EvictCapacity {
+				t.Fatalf("%s: unexpected reason %v for %s", p, reason, key)
+			}
+			evicted = append(evicted, key)
+		})
+		c.AddWithExpire("key1", bytesView("123456"), time.Time{})
+		for _, key := range []string{"k2", "k3", "k4"} {
+			c.AddWithExpire(key, bytesView(key), time.Time{})
+		}
+		if c.Bytes() > 10 || len(evicted) != 2 || evicted[0] != "key1" {
+			t.Fatalf("%s: expected key1 and one more evicted within 10 bytes, got %v, %d bytes", p, evicted, c.Bytes())
+		}
+		victim, ok := c.Victim()
+		c.RemoveOldest()
+		if !ok || evicted[len(evicted)-1] != victim {
+			t.Fatalf("%s: Victim returned %s, RemoveOldest evicted %v", p, victim, evicted)
+		}
+
+		reasons := make(map[string]lru.EvictReason)
+		c = newPolicy(p, 0, func(key string, value lru.Value, reason lru.EvictReason) {
+			reasons[key] = reason
+		})
+		past := time.Now().Add(-time.Second)
+		c.AddWithExpire("k1", bytesView("v1"), past)
+		c.AddWithExpire("k2", bytesView("v2"), past)
+		c.AddWithExpire("k3", bytesView("v3"), time.Now().Add(time.Minute))
+		c.AddWithExpire("k4", bytesView("v4"), time.Time{})
+		if _, ok := c.Get("k1"); ok {
+			t.Fatalf("%s: lazy expire k1 failed", p)
+		}
+		if n := c.RemoveExpired(); n != 1 || c.Len() != 2 {
+			t.Fatalf("%s: RemoveExpired removed %d, left %d", p, n, c.Len())
+		}
+		if !c.Remove("k4") || c.Remove("k4") {
+			t.Fatalf("%s: Remove k4 failed", p)
+		}
+		if _, ok := c.Get("k3"); !ok || c.Bytes() != int64(len("k3")+len("v3")) {
+			t.Fatalf("%s: k3 should not expire yet", p)
+		}
+		expect := map[string]lru.EvictReason{"k1": lru.EvictExpired, "k2": lru.EvictExpired, "k4": lru.EvictRemoved}
+		if !reflect.DeepEqual(expect, reasons) {
+			t.Fatalf("%s: OnEvicted called with reasons %v, expect %v", p, reasons, expect)
+		}
+	}
+}
+
+// hitRatio replays keys against a policy, adding the key on every miss.
+func hitRatio(p EvictionPolicy, maxBytes int64, keys []string) float64 {
+	c := newPolicy(p, maxBytes, nil)
+	hits := 0
+	for _, key := range keys {
+		if _, ok := c.Get(key); ok {
+			hits++
+			continue
+		}
+		c.AddWithExpire(key, ByteView{b: make([]byte, 16)}, time.Time{})
+	}
+	return float64(hits) / float64(len(keys))
+}
+
+// admissionHitRatio replays keys against a cache with the admission filter.
+func admissionHitRatio(p EvictionPolicy, maxBytes int64, keys []string) float64 {
+	c := &cache{cacheBytes: maxBytes, policy: p, admission: true}
+	hits := 0
+	for _, key := range keys {
+		if _, ok := c.get(key); ok {
+			hits++
+			continue
+		}
+		c.add(key, ByteView{b: make([]byte, 16)})
+	}
+	return float64(hits) / float64(len(keys))
+}
+
+// zipfKeys 生成符合 zipf 分布的访问序列，少量的热点数据占据大部分访问
+func zipfKeys(r *rand.Rand, n int, max uint64) []string {
+	z := rand.NewZipf(r, 1.1, 1, max)
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%06d", z.Uint64())
+	}
+	return keys
+}
+
+// scanKeys 在 zipf 访问中穿插一次性的顺序扫描
+func scanKeys(r *rand.Rand, n int, max uint64) []string {
+	keys := make([]string, 0, 2*n)
+	hot := zipfKeys(r, n, max)
+	for i := 0; i < n; i += 1000 {
+		keys = append(keys, hot[i:i+1000]...)
+		for j := 0; j < 500; j++ {
+			keys = append(keys, fmt.Sprintf("scan%d-%d", i, j))
+		}
+	}
+	return keys
+}
+
+func TestHitRatio(t *testing.T) {
+	const entryBytes = 9 + 16
+	maxBytes := int64(entryBytes * 500)
+	workloads := map[string][]string{
+		"zipf": zipfKeys(rand.New(rand.NewSource(1)), 100000, 10000),
+		"scan": scanKeys(rand.New(rand.NewSource(1)), 100000, 10000),
+	}
+	ratios := make(map[string]map[EvictionPolicy]float64)
+	for name, keys := range workloads {
+		ratios[name] = make(map[EvictionPolicy]float64)
+		for _, p := range policies {
+			ratios[name][p] = hitRatio(p, maxBytes, keys)
+			t.Logf("%s %s hit ratio: %.4f", name, p, ratios[name][p])
+		}
+	}
+
+	for name, keys := range workloads {
+		ratio := admissionHitRatio(PolicyLRU, maxBytes, keys)
+		t.Logf("%s w-tinylfu hit ratio: %.4f", name, ratio)
+		if ratio <= ratios[name][PolicyLRU] {
+			t.Errorf("%s: w-tinylfu hit ratio %.4f should be higher than lru %.4f", name, ratio, ratios[name][PolicyLRU])
+		}
+	}
+
+	for _, p := range []EvictionPolicy{PolicyLFU, PolicyARC, Policy2Q} {
+		if ratios["zipf"][p] < ratios["zipf"][PolicyLRU] {
+			t.Errorf("zipf: %s hit ratio %.4f should not be lower than lru %.4f", p, ratios["zipf"][p], ratios["zipf"][PolicyLRU])
+		}
+	}
+	for _, p := range []EvictionPolicy{PolicyLFU, PolicyARC, Policy2Q} {
+		if ratios["scan"][p] <= ratios["scan"][PolicyLRU] {
+			t.Errorf("scan: %s hit ratio %.4f should be higher than lru %.4f", p, ratios["scan"][p], ratios["scan"][PolicyLRU])
+		}
+	}
+}
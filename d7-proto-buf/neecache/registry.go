@@ -0,0 +1,122 @@
+package neecache
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+// A Registry holds groups by name. HTTPPool looks up the groups requested by
+// peers in its registry, DefaultRegistry unless NewHTTPPoolWithRegistry is used.
+// 测试等场景可以使用各自的 Registry，互不影响
+type Registry struct {
+	mu     sync.RWMutex
+	groups map[string]*Group
+}
+
+// DefaultRegistry holds the groups created by NewGroup and NewGroupWithOptions.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{groups: make(map[string]*Group)}
+}
+
+// NewGroup creates a group in r, it fails if a group with the same name exists.
+func (r *Registry) NewGroup(name string, getter Getter, opts ...Option) (*Group, error) {
+	if getter == nil {
+		return nil, errors.New("nil Getter")
+	}
+	return r.newGroup(name, getterNoCtx{getter}, false, opts...)
+}
+
+// NewGroupCtx is like NewGroup for a getter receiving the context of GetContext.
+func (r *Registry) NewGroupCtx(name string, getter GetterCtx, opts ...Option) (*Group, error) {
+	if getter == nil {
+		return nil, errors.New("nil Getter")
+	}
+	return r.newGroup(name, getter, false, opts...)
+}
+
+// newGroup 创建并注册 group，replace 为 true 时替换同名的 group 并停止其后台任务，
+// 与 NewGroup 等旧接口原有的行为一致
+func (r *Registry) newGroup(name string, getter GetterCtx, replace bool, opts ...Option) (*Group, error) {
+	if name == batchPath {
+		return nil, fmt.Errorf("group name %s is reserved", name)
+	}
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	g := newGroup(name, getter, o)
+	r.mu.Lock()
+	old, ok := r.groups[name]
+	if ok && !replace {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("duplicate registration of group %s", name)
+	}
+	r.groups[name] = g
+	r.mu.Unlock()
+	if ok {
+		log.Printf("[NeeCache] group %s registered again, replacing it", name)
+		old.close()
+	}
+	return g, nil
+}
+
+// GetGroup returns the named group or nil if there`s no such group.
+func (r *Registry) GetGroup(name string) *Group {
+	r.mu.RLock()
+	g := r.groups[name]
+	r.mu.RUnlock()
+	return g
+}
+
+// DeleteGroup removes the named group from r and stops its background work.
+// It reports whether the group existed. Peers can no longer request the group.
+func (r *Registry) DeleteGroup(name string) bool {
+	r.mu.Lock()
+	g, ok := r.groups[name]
+	delete(r.groups, name)
+	r.mu.Unlock()
+	if ok {
+		g.close()
+	}
+	return ok
+}
+
+// ListGroups returns the names of the groups in r in sorted order.
+func (r *Registry) ListGroups() []string {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.groups))
+	for name := range r.groups {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// sortedGroups returns all groups of r ordered by name.
+func (r *Registry) sortedGroups() []*Group {
+	r.mu.RLock()
+	list := make([]*Group, 0, len(r.groups))
+	for _, g := range r.groups {
+		list = append(list, g)
+	}
+	r.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
+
+// DeleteGroup removes the named group from the default registry.
+func DeleteGroup(name string) bool {
+	return DefaultRegistry.DeleteGroup(name)
+}
+
+// ListGroups returns the names of the groups in the default registry.
+func ListGroups() []string {
+	return DefaultRegistry.ListGroups()
+}
@@ -0,0 +1,114 @@
+package neecache
+
+import (
+	"context"
+	"neecache/neecachepb"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	for _, name := range []string{"scores", "users"} {
+		if _, err := r.NewGroup(name, getter); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.NewGroup("scores", getter); err == nil {
+		t.Fatalf("duplicate group name should fail")
+	}
+	if _, err := r.NewGroup("nil", nil); err == nil {
+		t.Fatalf("nil getter should fail")
+	}
+	if names := r.ListGroups(); !reflect.DeepEqual(names, []string{"scores", "users"}) {
+		t.Fatalf("unexpected groups %v", names)
+	}
+	if r.GetGroup("users") == nil || GetGroup("users") != nil {
+		t.Fatalf("groups of a registry should not be visible in the default registry")
+	}
+	if !r.DeleteGroup("users") || r.DeleteGroup("users") || r.GetGroup("users") != nil {
+		t.Fatalf("delete users failed")
+	}
+	if _, err := r.NewGroup("users", getter); err != nil {
+		t.Fatalf("name of a deleted group should be reusable: %v", err)
+	}
+}
+
+func TestNewGroupReplace(t *testing.T) {
+	defer DeleteGroup("legacy-replace")
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	first := NewGroup("legacy-replace", 2<<10, getter)
+	// 旧接口名称重复时替换原有的 group，不会 panic
+	second := NewGroupCtx("legacy-replace", 2<<10, GetterCtxFunc(func(_ context.Context, key string) ([]byte, error) {
+		return []byte("new-" + key), nil
+	}))
+	if first == second || GetGroup("legacy-replace") != second {
+		t.Fatalf("NewGroup should replace the group with the same name")
+	}
+	if view, err := GetGroup("legacy-replace").Get("Tom"); err != nil || view.String() != "new-Tom" {
+		t.Fatalf("expected the new getter to be used, got %q", view.String())
+	}
+	if _, err := NewGroupWithOptions("legacy-replace", getter); err == nil {
+		t.Fatalf("NewGroupWithOptions should fail on a duplicate name")
+	}
+}
+
+func TestNewGroupWithOptions(t *testing.T) {
+	r := NewRegistry()
+	var evicted []string
+	nee, err := r.NewGroup("options", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}),
+		WithCacheBytes(20),
+		WithPolicy(PolicyLFU),
+		WithShards(1),
+		WithTTL(time.Hour),
+		WithHotCache(0, 0),
+		WithNegativeTTL(time.Minute),
+		WithOnEvicted(func(key string, value ByteView) {
+			evicted = append(evicted, key)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nee.TTL() != time.Hour || nee.negativeTTL != time.Minute || nee.hotCache.cacheBytes != 0 {
+		t.Fatalf("options should be applied")
+	}
+	// 每个键值对 10 字节，第三个写入时淘汰访问频次最低的 key2
+	for _, key := range []string{"key1", "key1", "key2", "key3"} {
+		if _, err := nee.Get(key + "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(evicted, []string{"key2v"}) {
+		t.Fatalf("expected key2v to be evicted, got %v", evicted)
+	}
+}
+
+func TestHTTPPoolRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.NewGroup("isolated", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("isolated-" + key), nil
+	}))
+	server := httptest.NewServer(NewHTTPPoolWithRegistry("server", r))
+	defer server.Close()
+	getter := &httpGetter{baseURL: server.URL + defaultBasePath, latency: newHistogram(defaultBuckets)}
+
+	out := &neecachepb.Response{}
+	in := &neecachepb.Request{Group: "isolated", Key: "Tom"}
+	if err := getter.Get(context.Background(), in, out); err != nil || string(out.GetValue()) != "isolated-Tom" {
+		t.Fatalf("pool should serve the groups of its registry, got %v", err)
+	}
+	in.Group = "scores"
+	if err := getter.Get(context.Background(), in, out); err == nil {
+		t.Fatalf("pool should not serve groups of the default registry")
+	}
+}
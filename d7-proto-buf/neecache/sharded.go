@@ -0,0 +1,179 @@
+package neecache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// shardedCache splits keys over independent cache shards selected by key hash.
+// 每个分片有自己的锁和 cacheBytes/n 的内存预算，访问不同分片的协程不会竞争同一把锁
+type shardedCache struct {
+	cacheBytes int64        // 所有分片的内存总预算
+	shards     atomic.Value // []*cache，重新分片时整体替换
+}
+
+func newShardedCache(n int, cacheBytes int64, policy EvictionPolicy) *shardedCache {
+	return newShardedCacheFrom(n, &cache{cacheBytes: cacheBytes, policy: policy})
+}
+
+// newShardedCacheFrom creates n shards sharing the configuration of tmpl,
+// tmpl.cacheBytes is the budget of all shards.
+func newShardedCacheFrom(n int, tmpl *cache) *shardedCache {
+	s := &shardedCache{cacheBytes: tmpl.cacheBytes}
+	s.shards.Store(newShards(n, tmpl))
+	return s
+}
+
+// newShards creates n empty shards sharing the configuration of tmpl.
+func newShards(n int, tmpl *cache) []*cache {
+	if n < 1 {
+		n = 1
+	}
+	shardBytes := tmpl.cacheBytes / int64(n)
+	if tmpl.cacheBytes > 0 && shardBytes == 0 {
+		shardBytes = 1
+	}
+	shards := make([]*cache, n)
+	for i := range shards {
+		shards[i] = &cache{
+			cacheBytes:    shardBytes,
+			policy:        tmpl.policy,
+			ttl:           tmpl.ttl,
+			stale:         tmpl.stale,
+			sweepInterval: tmpl.sweepInterval,
+			admission:     tmpl.admission,
+			onEvict:       tmpl.onEvict,
+		}
+	}
+	return shards
+}
+
+func (s *shardedCache) all() []*cache {
+	return s.shards.Load().([]*cache)
+}
+
+// shard 使用 FNV-1a 哈希选择 key 所在的分片
+func (s *shardedCache) shard(key string) *cache {
+	shards := s.all()
+	if len(shards) == 1 {
+		return shards[0]
+	}
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return shards[h%uint32(len(shards))]
+}
+
+func (s *shardedCache) add(key string, value ByteView) {
+	s.shard(key).add(key, value)
+}
+
+func (s *shardedCache) get(key string) (value ByteView, ok bool) {
+	return s.shard(key).get(key)
+}
+
+func (s *shardedCache) getEntry(key string) (e entry, ok bool) {
+	return s.shard(key).getEntry(key)
+}
+
+func (s *shardedCache) remove(key string) bool {
+	return s.shard(key).remove(key)
+}
+
+// reshard replaces the shards with n empty ones, cached values are dropped.
+func (s *shardedCache) reshard(n int) {
+	old := s.all()
+	c := old[0]
+	c.mu.Lock()
+	tmpl := &cache{
+		cacheBytes:    s.cacheBytes,
+		policy:        c.policy,
+		ttl:           c.ttl,
+		stale:         c.stale,
+		sweepInterval: c.sweepInterval,
+		admission:     c.admission,
+		onEvict:       c.onEvict,
+	}
+	c.mu.Unlock()
+	s.shards.Store(newShards(n, tmpl))
+	for _, c := range old {
+		c.close()
+	}
+}
+
+func (s *shardedCache) setTTL(ttl time.Duration) {
+	for _, c := range s.all() {
+		c.setTTL(ttl)
+	}
+}
+
+func (s *shardedCache) setStale(stale time.Duration) {
+	for _, c := range s.all() {
+		c.setStale(stale)
+	}
+}
+
+func (s *shardedCache) ttl() time.Duration {
+	c := s.all()[0]
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ttl
+}
+
+func (s *shardedCache) setAdmission(enabled bool) {
+	for _, c := range s.all() {
+		c.setAdmission(enabled)
+	}
+}
+
+func (s *shardedCache) admissionStats() (admitted, rejected int64) {
+	for _, c := range s.all() {
+		a, r := c.admissionStats()
+		admitted += a
+		rejected += r
+	}
+	return
+}
+
+// CacheStats returns the statistics of all shards added up.
+func (s *shardedCache) CacheStats() CacheStats {
+	var stats CacheStats
+	for _, c := range s.all() {
+		cs := c.CacheStats()
+		stats.Bytes += cs.Bytes
+		stats.Items += cs.Items
+		stats.Gets += cs.Gets
+		stats.Hits += cs.Hits
+		stats.Evictions += cs.Evictions
+	}
+	return stats
+}
+
+func (s *shardedCache) bytes() int64 {
+	var n int64
+	for _, c := range s.all() {
+		n += c.bytes()
+	}
+	return n
+}
+
+// removeOldest evicts from the shard using the most bytes.
+func (s *shardedCache) removeOldest() {
+	var victim *cache
+	var max int64
+	for _, c := range s.all() {
+		if n := c.bytes(); victim == nil || n > max {
+			victim, max = c, n
+		}
+	}
+	victim.removeOldest()
+}
+
+// close stops the background sweepers of all shards.
+func (s *shardedCache) close() {
+	for _, c := range s.all() {
+		c.close()
+	}
+}
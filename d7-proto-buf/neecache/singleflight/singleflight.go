@@ -1,16 +1,62 @@
 package singleflight
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
 	"sync"
+	"time"
 )
 
-// call 代表正在进行中，或已结束的请求。使用 sync.WaitGroup 锁避免重入
+// call 代表正在进行中，或已结束的请求。done 在请求结束时关闭，等待者可以同时监听自己的 context
 type call struct {
-	wg  sync.WaitGroup
-	val interface{}
-	err error
+	done chan struct{}
+	val  interface{}
+	err  error
+
+	// 由 DoContext 发起的请求使用与调用者的取消无关的 ctx，最后一个等待者离开时才取消
+	cancel  context.CancelFunc
+	waiters int // guarded by Group.mu
+	// owner 是 DoMulti 发起请求的调用者的 ctx，fn 随其一同取消
+	owner context.Context
+}
+
+// abandoned reports whether the call failed only because the ctx of the
+// caller that ran it was done, the result says nothing about the key.
+func (c *call) abandoned() bool {
+	return c.owner != nil && c.owner.Err() != nil && c.err != nil &&
+		(errors.Is(c.err, context.Canceled) || errors.Is(c.err, context.DeadlineExceeded))
+}
+
+// panicError is the error of a call whose fn panicked, every caller waiting
+// for the call panics with it on its own goroutine.
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (p *panicError) Error() string {
+	return fmt.Sprintf("%v\n\n%s", p.value, p.stack)
+}
+
+// result 返回 c 的结果，fn panic 时在调用者的协程中重新 panic
+func (c *call) result() (interface{}, error) {
+	if p, ok := c.err.(*panicError); ok {
+		panic(p)
+	}
+	return c.val, c.err
 }
 
+// detached carries the values of a context but neither its deadline nor its cancellation.
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
 // Group 是 singleflight 的主数据结构，管理不通 key 的请求(call)
 type Group struct {
 	mu sync.Mutex // protects m
@@ -20,27 +66,186 @@ type Group struct {
 // Do 接受两个参数，第一个参数是key， 第二个参数是一个甘薯fn,Do的所用就是，针对相同的key
 // 无论Do被调用多少次，函数 fn  都只会被调用一次，等待 fn 调用结束了，返回返回值或错误
 func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	return g.DoContext(context.Background(), key, func(context.Context) (interface{}, error) {
+		return fn()
+	})
+}
+
+// DoContext is like Do, but every caller, including the one that started the
+// call, returns ctx.Err() as soon as its own ctx is done. fn is called with a
+// context carrying the values of the first caller's ctx, which is cancelled
+// only once every caller waiting for the result has returned, so that one
+// caller giving up does not fail the others.
+// 等待由 DoMulti 发起的请求时，若该请求因发起者的 ctx 结束而失败，则重新发起
+func (g *Group) DoContext(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	for {
+		c := g.join(ctx, key, fn)
+		select { // 如果 fn 请求正在进行中，则等待，除非自己的 ctx 先结束
+		case <-c.done:
+			g.leave(key, c)
+			if c.abandoned() && ctx.Err() == nil {
+				continue
+			}
+			return c.result()
+		case <-ctx.Done():
+			g.leave(key, c)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// join 返回 key 正在进行中的请求并登记为其等待者，没有时在新的协程中执行 fn。
+// fn 的 panic 在该协程中恢复，由等待者重新 panic，不会使整个进程退出
+func (g *Group) join(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) *call {
 	g.mu.Lock()
+	defer g.mu.Unlock()
 	// 延迟加载
 	if g.m == nil {
 		g.m = make(map[string]*call)
 	}
-	if c, ok := g.m[key]; ok {
-		g.mu.Unlock() // 0⃣ 非 fn 请求 在这段时间尽量都走到这儿
-		c.wg.Wait()   // 1⃣ 如果 fn 请求正在进行中，则等待
-		return c.val, c.err
+	c, ok := g.m[key]
+	if !ok {
+		c = &call{done: make(chan struct{})}
+		var callCtx context.Context
+		callCtx, c.cancel = context.WithCancel(detached{ctx})
+		g.m[key] = c // 绑定c
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					c.err = &panicError{value: r, stack: debug.Stack()}
+				}
+				c.cancel()
+				g.mu.Lock()
+				g.forget(key, c)
+				g.mu.Unlock()
+				close(c.done) // 请求结束，此时值已经存完了，等待中的协程被唤醒
+			}()
+			c.val, c.err = fn(callCtx)
+		}()
 	}
-	c := new(call)
-	c.wg.Add(1)  // 发起请求前加锁
-	g.m[key] = c // 绑定c
-	g.mu.Unlock()
+	c.waiters++
+	return c
+}
+
+// leave 注销一个等待者，最后一个等待者在请求结束前离开时取消请求
+func (g *Group) leave(key string, c *call) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.waiters--
+	if c.waiters == 0 && c.cancel != nil {
+		select {
+		case <-c.done:
+		default:
+			// 之后的调用者发起新的请求，而不是等待一个已取消的请求
+			g.forget(key, c)
+			c.cancel()
+		}
+	}
+}
 
-	c.val, c.err = fn() // 在fn 运行完之前，其他协程 都能执行到
-	c.wg.Done()         // 请求结束，此时值已经存完了，其他协程抢占成功后 抵达 1⃣ 阻塞
+// forget removes c from g.m if it is still the call of key.
+// g.mu must be held.
+func (g *Group) forget(key string, c *call) {
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
+}
+
+// Result is the result of one key of DoMulti.
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool // 复用了其他调用者正在进行的请求
+}
 
+// DoMulti is like DoContext for many keys at once. Keys already in flight,
+// started by Do or DoMulti, share the result of that call, fn is called once
+// with all the other keys and must return a result for each of them.
+// Unlike DoContext, fn is called with ctx, a caller waiting for a key of a
+// DoMulti whose ctx is done loads that key again.
+// 调用者先执行自己负责的 key，再等待其他调用者负责的 key，因此不会相互等待而死锁
+func (g *Group) DoMulti(ctx context.Context, keys []string, fn func(ctx context.Context, keys []string) map[string]Result) map[string]Result {
+	results := make(map[string]Result, len(keys))
+	own := make(map[string]*call)
+	var ownKeys []string // 保持 keys 中的顺序
+	waiting := make(map[string]*call)
 	g.mu.Lock()
-	delete(g.m, key) // 更新 g.m
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	for _, key := range keys {
+		if _, ok := own[key]; ok {
+			continue
+		}
+		if c, ok := g.m[key]; ok {
+			c.waiters++
+			waiting[key] = c
+			continue
+		}
+		c := &call{done: make(chan struct{}), owner: ctx}
+		g.m[key] = c
+		own[key] = c
+		ownKeys = append(ownKeys, key)
+	}
 	g.mu.Unlock()
 
-	return c.val, c.err // 返回结果
+	if len(ownKeys) > 0 {
+		res := g.callMulti(ctx, own, ownKeys, fn)
+		g.mu.Lock()
+		for key, c := range own {
+			r, ok := res[key]
+			if !ok {
+				r.Err = fmt.Errorf("singleflight: no result for key %q", key)
+			}
+			c.val, c.err = r.Val, r.Err
+			close(c.done)
+			g.forget(key, c)
+			results[key] = Result{Val: r.Val, Err: r.Err}
+		}
+		g.mu.Unlock()
+	}
+
+	for key, c := range waiting {
+		select {
+		case <-c.done:
+			g.leave(key, c)
+			if c.abandoned() && ctx.Err() == nil {
+				// 发起者放弃了请求，单独重新加载该 key
+				val, err := g.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+					r, ok := fn(ctx, []string{key})[key]
+					if !ok {
+						r.Err = fmt.Errorf("singleflight: no result for key %q", key)
+					}
+					return r.Val, r.Err
+				})
+				results[key] = Result{Val: val, Err: err}
+				continue
+			}
+			val, err := c.result()
+			results[key] = Result{Val: val, Err: err, Shared: true}
+		case <-ctx.Done():
+			g.leave(key, c)
+			results[key] = Result{Err: ctx.Err(), Shared: true}
+		}
+	}
+	return results
+}
+
+// callMulti 在调用者的协程中执行 fn，fn panic 时先结束 own 中的请求，
+// 等待这些 key 的其他调用者随之 panic，而不是一直等待
+func (g *Group) callMulti(ctx context.Context, own map[string]*call, keys []string, fn func(ctx context.Context, keys []string) map[string]Result) map[string]Result {
+	defer func() {
+		if r := recover(); r != nil {
+			err := &panicError{value: r, stack: debug.Stack()}
+			g.mu.Lock()
+			for key, c := range own {
+				c.err = err
+				close(c.done)
+				g.forget(key, c)
+			}
+			g.mu.Unlock()
+			panic(err)
+		}
+	}()
+	return fn(ctx, keys)
 }
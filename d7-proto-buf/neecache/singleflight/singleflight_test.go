@@ -0,0 +1,262 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group
+	var calls int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := g.Do("key", func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "bar", nil
+			})
+			if v != "bar" || err != nil {
+				t.Errorf("Do = %v, %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("fn should be called once, got %d", n)
+	}
+}
+
+func TestDoContextWaiterCancel(t *testing.T) {
+	var g Group
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan interface{})
+	go func() {
+		v, _ := g.DoContext(context.Background(), "key", func(context.Context) (interface{}, error) {
+			close(started)
+			<-release
+			return "bar", nil
+		})
+		done <- v
+	}()
+	<-started
+
+	// 等待者的 ctx 结束后立即返回，不影响正在进行的调用
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := g.DoContext(ctx, "key", func(context.Context) (interface{}, error) {
+		t.Fatalf("fn should not be called while another call is in flight")
+		return nil, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+	close(release)
+	if v := <-done; v != "bar" {
+		t.Fatalf("in-flight call should complete, got %v", v)
+	}
+}
+
+func TestDoContextLeaderCancel(t *testing.T) {
+	var g Group
+	started, release := make(chan struct{}), make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error)
+	go func() {
+		_, err := g.DoContext(ctx, "key", func(ctx context.Context) (interface{}, error) {
+			close(started)
+			<-release
+			return "bar", ctx.Err()
+		})
+		leader <- err
+	}()
+	<-started
+	waiter := make(chan interface{})
+	go func() {
+		v, err := g.DoContext(context.Background(), "key", func(context.Context) (interface{}, error) {
+			return nil, errors.New("fn should not be called again")
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		waiter <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// 发起者离开后，请求继续为仍在等待的调用者执行
+	cancel()
+	if err := <-leader; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled for the leader, got %v", err)
+	}
+	close(release)
+	if v := <-waiter; v != "bar" {
+		t.Fatalf("waiter should get the value, got %v", v)
+	}
+}
+
+func TestDoContextAllCancel(t *testing.T) {
+	var g Group
+	started, cancelled := make(chan struct{}), make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	_, err := g.DoContext(ctx, "key", func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatalf("fn should be cancelled once no caller is waiting")
+	}
+	// 已取消的请求不再被复用
+	if v, err := g.Do("key", func() (interface{}, error) { return "bar", nil }); v != "bar" || err != nil {
+		t.Fatalf("Do = %v, %v", v, err)
+	}
+}
+
+func TestDoMultiLeaderCancel(t *testing.T) {
+	var g Group
+	started := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go g.DoMulti(ctx, []string{"a"}, func(ctx context.Context, keys []string) map[string]Result {
+		close(started)
+		<-ctx.Done()
+		return map[string]Result{"a": {Err: ctx.Err()}}
+	})
+	<-started
+	done := make(chan interface{})
+	go func() {
+		v, _ := g.DoContext(context.Background(), "a", func(context.Context) (interface{}, error) {
+			return "A", nil
+		})
+		done <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if v := <-done; v != "A" {
+		t.Fatalf("waiter should load a again after the DoMulti is cancelled, got %v", v)
+	}
+}
+
+// recovered 调用 f 并返回其 panic 的值
+func recovered(f func()) (r interface{}) {
+	defer func() {
+		r = recover()
+	}()
+	f()
+	return nil
+}
+
+func TestDoContextPanic(t *testing.T) {
+	var g Group
+	started, release := make(chan struct{}), make(chan struct{})
+	panics := make(chan interface{}, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			panics <- recovered(func() {
+				g.DoContext(context.Background(), "key", func(context.Context) (interface{}, error) {
+					close(started)
+					<-release
+					panic("boom")
+				})
+			})
+		}()
+	}
+	<-started
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	// fn 的 panic 在每个调用者的协程中重新抛出，调用者可以恢复
+	for i := 0; i < 2; i++ {
+		p, ok := (<-panics).(*panicError)
+		if !ok || p.value != "boom" {
+			t.Fatalf("callers should panic with the panic of fn, got %v", p)
+		}
+	}
+	if v, err := g.Do("key", func() (interface{}, error) { return "bar", nil }); v != "bar" || err != nil {
+		t.Fatalf("key should be loaded again after a panic, got %v, %v", v, err)
+	}
+}
+
+func TestDoMultiPanic(t *testing.T) {
+	var g Group
+	started := make(chan struct{})
+	release := make(chan struct{})
+	leader := make(chan interface{})
+	go func() {
+		leader <- recovered(func() {
+			g.DoMulti(context.Background(), []string{"a"}, func(context.Context, []string) map[string]Result {
+				close(started)
+				<-release
+				panic("boom")
+			})
+		})
+	}()
+	<-started
+	waiter := make(chan interface{})
+	go func() {
+		waiter <- recovered(func() {
+			g.DoContext(context.Background(), "a", func(context.Context) (interface{}, error) {
+				return "A", nil
+			})
+		})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	// 等待者不会一直等待发起者 panic 的请求
+	for _, ch := range []chan interface{}{leader, waiter} {
+		if _, ok := (<-ch).(*panicError); !ok {
+			t.Fatalf("both callers should panic")
+		}
+	}
+}
+
+func TestDoMulti(t *testing.T) {
+	var g Group
+	started, release := make(chan struct{}), make(chan struct{})
+	go g.Do("a", func() (interface{}, error) {
+		close(started)
+		<-release
+		return "A", nil
+	})
+	<-started
+
+	var batch []string
+	done := make(chan map[string]Result)
+	go func() {
+		done <- g.DoMulti(context.Background(), []string{"a", "b", "c", "b"}, func(_ context.Context, keys []string) map[string]Result {
+			batch = keys
+			close(release)
+			return map[string]Result{"b": {Val: "B"}, "c": {Err: errors.New("c failed")}}
+		})
+	}()
+	results := <-done
+	if len(batch) != 2 || batch[0] != "b" || batch[1] != "c" {
+		t.Fatalf("fn should be called once with the keys not in flight, got %v", batch)
+	}
+	if r := results["a"]; r.Val != "A" || !r.Shared {
+		t.Fatalf("in-flight key should share the result, got %+v", r)
+	}
+	if r := results["b"]; r.Val != "B" || r.Shared {
+		t.Fatalf("unexpected result for b: %+v", r)
+	}
+	if results["c"].Err == nil {
+		t.Fatalf("error of c should be returned")
+	}
+}
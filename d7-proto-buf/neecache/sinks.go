@@ -0,0 +1,124 @@
+package neecache
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// A Sink receives a value from Group.GetSink.
+// 由 Sink 决定如何使用缓存的值，避免先复制一份再解码
+type Sink interface {
+	// SetView sets the value of the sink. v is shared with the cache and must
+	// not be modified, the sink copies or decodes what it keeps.
+	SetView(v ByteView) error
+}
+
+// GetSink is like GetContext, the value is delivered to dest.
+func (g *Group) GetSink(ctx context.Context, key string, dest Sink) error {
+	if dest == nil {
+		return errors.New("nil Sink")
+	}
+	view, err := g.GetContext(ctx, key)
+	if err != nil {
+		return err
+	}
+	return dest.SetView(view)
+}
+
+// StringSink returns a Sink that populates the provided string pointer.
+func StringSink(sp *string) Sink {
+	return &stringSink{sp: sp}
+}
+
+type stringSink struct {
+	sp *string
+}
+
+func (s *stringSink) SetView(v ByteView) error {
+	b, err := v.bytes()
+	if err != nil {
+		return err
+	}
+	*s.sp = string(b)
+	return nil
+}
+
+// ByteViewSink returns a Sink that populates a ByteView. The value is not copied.
+func ByteViewSink(dst *ByteView) Sink {
+	return &byteViewSink{dst: dst}
+}
+
+type byteViewSink struct {
+	dst *ByteView
+}
+
+func (s *byteViewSink) SetView(v ByteView) error {
+	*s.dst = v
+	return nil
+}
+
+// AllocatingByteSliceSink returns a Sink that allocates
+// a byte slice to hold the received value and assigns
+// it to *dst. The memory is not retained by neecache.
+func AllocatingByteSliceSink(dst *[]byte) Sink {
+	return &allocBytesSink{dst: dst}
+}
+
+type allocBytesSink struct {
+	dst *[]byte
+}
+
+func (s *allocBytesSink) SetView(v ByteView) error {
+	b, err := v.bytes()
+	if err != nil {
+		return err
+	}
+	if v.c == nil {
+		b = cloneBytes(b)
+	}
+	*s.dst = b
+	return nil
+}
+
+// TruncatingByteSliceSink returns a Sink that writes up to len(*dst)
+// bytes to *dst. If more bytes are available, they're silently
+// truncated. If fewer bytes are available than len(*dst), *dst
+// is shrunk to fit the number of bytes available.
+// 复用调用方的内存，未压缩的值不会额外分配
+func TruncatingByteSliceSink(dst *[]byte) Sink {
+	return &truncBytesSink{dst: dst}
+}
+
+type truncBytesSink struct {
+	dst *[]byte
+}
+
+func (s *truncBytesSink) SetView(v ByteView) error {
+	b, err := v.bytes()
+	if err != nil {
+		return err
+	}
+	n := copy(*s.dst, b)
+	*s.dst = (*s.dst)[:n]
+	return nil
+}
+
+// ProtoSink returns a sink that unmarshals binary proto values into m.
+// 直接从缓存的数据解码，不需要先复制
+func ProtoSink(m proto.Message) Sink {
+	return &protoSink{dst: m}
+}
+
+type protoSink struct {
+	dst proto.Message
+}
+
+func (s *protoSink) SetView(v ByteView) error {
+	b, err := v.bytes()
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(b, s.dst)
+}
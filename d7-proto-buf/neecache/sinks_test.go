@@ -0,0 +1,60 @@
+package neecache
+
+import (
+	"context"
+	"neecache/neecachepb"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSinks(t *testing.T) {
+	r := NewRegistry()
+	encoded, _ := proto.Marshal(&neecachepb.Request{Group: "scores", Key: "Tom"})
+	nee, _ := r.NewGroup("sinks", GetterFunc(func(key string) ([]byte, error) {
+		if key == "proto" {
+			return encoded, nil
+		}
+		return []byte(key + "-value"), nil
+	}))
+	ctx := context.Background()
+
+	var s string
+	if err := nee.GetSink(ctx, "Tom", StringSink(&s)); err != nil || s != "Tom-value" {
+		t.Fatalf("StringSink got %q, %v", s, err)
+	}
+
+	var b []byte
+	if err := nee.GetSink(ctx, "Tom", AllocatingByteSliceSink(&b)); err != nil || string(b) != "Tom-value" {
+		t.Fatalf("AllocatingByteSliceSink got %q, %v", b, err)
+	}
+	b[0] = 'X'
+	if view, _ := nee.Get("Tom"); view.String() != "Tom-value" {
+		t.Fatalf("modifying the allocated slice should not change the cache")
+	}
+
+	buf := make([]byte, 3, 16)
+	if err := nee.GetSink(ctx, "Tom", TruncatingByteSliceSink(&buf)); err != nil || string(buf) != "Tom" {
+		t.Fatalf("TruncatingByteSliceSink got %q, %v", buf, err)
+	}
+	buf = buf[:16]
+	if err := nee.GetSink(ctx, "Jack", TruncatingByteSliceSink(&buf)); err != nil || string(buf) != "Jack-value" {
+		t.Fatalf("TruncatingByteSliceSink should shrink to the value, got %q", buf)
+	}
+
+	var view ByteView
+	if err := nee.GetSink(ctx, "Tom", ByteViewSink(&view)); err != nil || view.String() != "Tom-value" {
+		t.Fatalf("ByteViewSink got %q, %v", view.String(), err)
+	}
+
+	req := &neecachepb.Request{}
+	if err := nee.GetSink(ctx, "proto", ProtoSink(req)); err != nil || req.GetKey() != "Tom" {
+		t.Fatalf("ProtoSink got %v, %v", req, err)
+	}
+	if err := nee.GetSink(ctx, "Tom", ProtoSink(req)); err == nil {
+		t.Fatalf("ProtoSink should fail on invalid data")
+	}
+	if err := nee.GetSink(ctx, "", StringSink(&s)); err == nil {
+		t.Fatalf("empty key should fail")
+	}
+}
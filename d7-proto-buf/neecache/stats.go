@@ -0,0 +1,41 @@
+package neecache
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// Stats are per-group statistics.
+type Stats struct {
+	Gets           AtomicInt // any Get request, including from peers
+	CacheHits      AtomicInt // either cache was good
+	Misses         AtomicInt // gets that missed both caches, (gets - cacheHits)
+	PeerLoads      AtomicInt // either remote load or remote cache hit (not an error)
+	PeerErrors     AtomicInt // failed remote loads
+	LocalLoads     AtomicInt // total good local loads
+	LocalLoadErrs  AtomicInt // total bad local loads
+	DedupedLoads   AtomicInt // misses that shared an in-flight load by singleflight
+	ServerRequests AtomicInt // gets that came over the network from peers
+	NegativeHits   AtomicInt // cache hits that were remembered misses, counted in CacheHits too
+	FilteredKeys   AtomicInt // misses rejected by the key filter without loading
+	Refreshes      AtomicInt // background reloads started by refresh-ahead
+	StaleHits      AtomicInt // expired values served because reloading them failed
+	FallbackLoads  AtomicInt // local loads of keys whose owning peer failed
+}
+
+// An AtomicInt is an int64 to be accessed atomically.
+type AtomicInt int64
+
+// Add atomically adds n to i.
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+// Get atomically gets the value of i.
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *AtomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
@@ -0,0 +1,82 @@
+package tinylfu
+
+import "hash/fnv"
+
+const (
+	sketchDepth = 4  // 哈希函数（行）的个数
+	maxCount    = 15 // 计数器上限，与 Caffeine 的 4 bit 计数器一致
+)
+
+// seeds 用于从同一个 64 位哈希值派生出每一行的下标
+var seeds = [sketchDepth]uint64{
+	0xc3a5c85c97cb3127, 0xb492b66fbe98f273,
+	0x9ae16a3b2f90404f, 0xcbf29ce484222325,
+}
+
+// cmSketch is a Count-Min Sketch with saturating counters.
+// 每个键在 depth 行中各对应一个计数器，估计值取其中的最小值，
+// 哈希冲突只会导致高估，不会低估
+type cmSketch struct {
+	rows [sketchDepth][]uint8
+	mask uint64
+}
+
+func newCmSketch(width int) *cmSketch {
+	w := nextPowerOfTwo(width)
+	s := &cmSketch{mask: uint64(w - 1)}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, w)
+	}
+	return s
+}
+
+func (s *cmSketch) index(h uint64, i int) uint64 {
+	h = (h + seeds[i]) * seeds[i]
+	return (h ^ h>>32) & s.mask
+}
+
+// increment adds one to the counters of h and reports whether any changed.
+func (s *cmSketch) increment(h uint64) bool {
+	added := false
+	for i := range s.rows {
+		idx := s.index(h, i)
+		if s.rows[i][idx] < maxCount {
+			s.rows[i][idx]++
+			added = true
+		}
+	}
+	return added
+}
+
+func (s *cmSketch) estimate(h uint64) uint8 {
+	min := uint8(maxCount)
+	for i := range s.rows {
+		if v := s.rows[i][s.index(h, i)]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// reset halves all counters so that old popularity fades away.
+func (s *cmSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+}
+
+func hash(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum64()
+}
+
+func nextPowerOfTwo(n int) int {
+	w := 1
+	for w < n {
+		w <<= 1
+	}
+	return w
+}
@@ -0,0 +1,68 @@
+package tinylfu
+
+// TinyLFU is a frequency based admission filter. It is not safe for concurrent access.
+// 使用 Count-Min Sketch 近似记录每个键最近的访问频次，新数据只有比将被淘汰的数据更热时
+// 才允许进入主缓存，避免只访问一次的数据把热点数据挤出缓存。
+// 每记录 sampleSize 次访问，所有计数减半（aging），让过去的热点逐渐冷却。
+type TinyLFU struct {
+	sketch     *cmSketch
+	samples    int // 自上次 reset 以来记录的访问次数
+	sampleSize int // 达到该次数后执行 reset
+	admitted   int64
+	rejected   int64
+	resets     int64
+}
+
+// New creates a TinyLFU sized for about counters distinct keys.
+func New(counters int) *TinyLFU {
+	if counters < 1 {
+		counters = 1
+	}
+	return &TinyLFU{
+		sketch:     newCmSketch(counters),
+		sampleSize: 10 * counters,
+	}
+}
+
+// Increment records an access to key.
+func (t *TinyLFU) Increment(key string) {
+	if t.sketch.increment(hash(key)) {
+		t.samples++
+	}
+	if t.samples >= t.sampleSize {
+		t.sketch.reset()
+		t.samples /= 2
+		t.resets++
+	}
+}
+
+// Estimate returns the estimated access frequency of key.
+func (t *TinyLFU) Estimate(key string) int {
+	return int(t.sketch.estimate(hash(key)))
+}
+
+// Admit reports whether candidate should replace victim in the main cache,
+// i.e. candidate is accessed more frequently than victim.
+func (t *TinyLFU) Admit(candidate, victim string) bool {
+	if t.Estimate(candidate) > t.Estimate(victim) {
+		t.admitted++
+		return true
+	}
+	t.rejected++
+	return false
+}
+
+// Admitted returns how many candidates were admitted by Admit.
+func (t *TinyLFU) Admitted() int64 {
+	return t.admitted
+}
+
+// Rejected returns how many candidates were rejected by Admit.
+func (t *TinyLFU) Rejected() int64 {
+	return t.rejected
+}
+
+// Resets returns how many times the counters were halved.
+func (t *TinyLFU) Resets() int64 {
+	return t.resets
+}
@@ -0,0 +1,64 @@
+package tinylfu
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	f := New(64)
+	for i := 0; i < 5; i++ {
+		f.Increment("hot")
+	}
+	f.Increment("cold")
+
+	if e := f.Estimate("hot"); e != 5 {
+		t.Fatalf("estimate of hot should be 5, got %d", e)
+	}
+	if e := f.Estimate("cold"); e != 1 {
+		t.Fatalf("estimate of cold should be 1, got %d", e)
+	}
+	if e := f.Estimate("unknown"); e != 0 {
+		t.Fatalf("estimate of unknown should be 0, got %d", e)
+	}
+	for i := 0; i < 100; i++ {
+		f.Increment("hot")
+	}
+	if e := f.Estimate("hot"); e != maxCount {
+		t.Fatalf("counter should saturate at %d, got %d", maxCount, e)
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	f := New(64)
+	f.Increment("hot")
+	f.Increment("hot")
+	f.Increment("cold")
+
+	if f.Admit("cold", "hot") || !f.Admit("hot", "cold") {
+		t.Fatalf("only the more frequent candidate should be admitted")
+	}
+	if f.Admitted() != 1 || f.Rejected() != 1 {
+		t.Fatalf("admitted: %d, rejected: %d", f.Admitted(), f.Rejected())
+	}
+}
+
+func TestReset(t *testing.T) {
+	f := New(16)
+	for i := 0; i < 8; i++ {
+		f.Increment("hot")
+	}
+	// 大量其他的访问触发 aging，所有计数减半
+	i := 0
+	for ; f.samples < f.sampleSize-1; i++ {
+		f.Increment(fmt.Sprintf("key%d", i))
+	}
+	before := f.Estimate("hot")
+	f.Increment(fmt.Sprintf("key%d", i))
+	if f.Resets() != 1 {
+		t.Fatalf("counters should be reset after %d samples", f.sampleSize)
+	}
+	if e := f.Estimate("hot"); e > (before+1)/2 {
+		t.Fatalf("estimate of hot should be halved from %d, got %d", before, e)
+	}
+}
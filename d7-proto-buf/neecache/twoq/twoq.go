@@ -0,0 +1,245 @@
+package twoq
+
+import (
+	"container/list"
+	"neecache/internal/queue"
+	"neecache/lru"
+	"time"
+)
+
+const (
+	// DefaultRecentRatio is the ratio of the cache dedicated to
+	// entries that have been accessed only once (A1in).
+	DefaultRecentRatio = 0.25
+	// DefaultGhostRatio is the ratio of the cache used to remember
+	// keys recently evicted from A1in (A1out).
+	DefaultGhostRatio = 0.5
+)
+
+// Cache is a 2Q cache. It is not safe for concurrent access.
+// 新键先进入 recent(A1in，FIFO)，再次访问时才提升到 frequent(Am，LRU)；
+// 从 recent 淘汰的键记录在 ghost(A1out) 中，若很快又被加入，则直接进入 frequent。
+// 只访问一次的扫描数据只会在 recent 中流转，不会冲刷 frequent 中的热点数据。
+type Cache struct {
+	maxBytes    int64 // 允许使用的最大内存
+	recentBytes int64 // recent 的目标字节数
+	ghostBytes  int64 // ghost 允许记录的字节数
+	recent      *queue.Queue
+	frequent    *queue.Queue
+	ghost       *queue.Queue
+	// optional and executed when an entry is purged
+	OnEvicted func(key string, value lru.Value, reason lru.EvictReason)
+	now       func() time.Time
+}
+
+// New is the constructor of Cache with the default ratios.
+func New(maxBytes int64, onEvicted func(string, lru.Value, lru.EvictReason)) *Cache {
+	return NewWithRatio(maxBytes, DefaultRecentRatio, DefaultGhostRatio, onEvicted)
+}
+
+// NewWithRatio creates a Cache with the given recent and ghost ratios.
+func NewWithRatio(maxBytes int64, recentRatio, ghostRatio float64, onEvicted func(string, lru.Value, lru.EvictReason)) *Cache {
+	if recentRatio < 0 || recentRatio > 1 {
+		panic("twoq: invalid recent ratio")
+	}
+	if ghostRatio < 0 || ghostRatio > 1 {
+		panic("twoq: invalid ghost ratio")
+	}
+	return &Cache{
+		maxBytes:    maxBytes,
+		recentBytes: int64(float64(maxBytes) * recentRatio),
+		ghostBytes:  int64(float64(maxBytes) * ghostRatio),
+		recent:      queue.New(),
+		frequent:    queue.New(),
+		ghost:       queue.New(),
+		OnEvicted:   onEvicted,
+		now:         time.Now,
+	}
+}
+
+// Get look ups a key`s value
+func (c *Cache) Get(key string) (value lru.Value, ok bool) {
+	if ele, ok := c.frequent.Lookup(key); ok {
+		e := ele.Value.(*queue.Entry)
+		if e.Expired(c.now()) {
+			c.evict(c.frequent, ele, lru.EvictExpired)
+			return nil, false
+		}
+		c.frequent.MoveToFront(ele)
+		return e.Value, true
+	}
+	if ele, ok := c.recent.Lookup(key); ok {
+		e := ele.Value.(*queue.Entry)
+		if e.Expired(c.now()) {
+			c.evict(c.recent, ele, lru.EvictExpired)
+			return nil, false
+		}
+		// 再次访问，从 recent 提升到 frequent
+		c.recent.Remove(ele)
+		c.frequent.PushFront(e)
+		return e.Value, true
+	}
+	return
+}
+
+// Add adds a value to the cache.
+func (c *Cache) Add(key string, value lru.Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithTTL adds a value to the cache which expires after ttl.
+// A non-positive ttl means the value never expires.
+func (c *Cache) AddWithTTL(key string, value lru.Value, ttl time.Duration) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = c.now().Add(ttl)
+	}
+	c.AddWithExpire(key, value, expire)
+}
+
+// AddWithExpire adds a value to the cache which expires at the given time.
+// A zero expire means the value never expires.
+func (c *Cache) AddWithExpire(key string, value lru.Value, expire time.Time) {
+	e := &queue.Entry{Key: key, Value: value, Size: int64(len(key)) + int64(value.Len()), Expire: expire}
+
+	if ele, ok := c.frequent.Lookup(key); ok {
+		c.frequent.Remove(ele)
+		c.frequent.PushFront(e)
+		c.trim()
+		return
+	}
+	// 已在 recent 中，再次写入视为第二次访问
+	if ele, ok := c.recent.Lookup(key); ok {
+		c.recent.Remove(ele)
+		c.frequent.PushFront(e)
+		c.trim()
+		return
+	}
+	// 近期从 recent 淘汰过，说明不是一次性数据，直接进入 frequent
+	if ele, ok := c.ghost.Lookup(key); ok {
+		c.ghost.Remove(ele)
+		c.ensureSpace(e.Size, true)
+		c.frequent.PushFront(e)
+		c.trim()
+		return
+	}
+
+	c.ensureSpace(e.Size, false)
+	c.recent.PushFront(e)
+	c.trim()
+}
+
+// ensureSpace 在插入 size 字节前淘汰节点
+func (c *Cache) ensureSpace(size int64, ghostHit bool) {
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.Len() > 0 && c.Bytes()+size > c.maxBytes {
+		c.removeOldest(ghostHit)
+	}
+}
+
+// RemoveOldest evicts the oldest item of recent when it exceeds its
+// target size, otherwise the least recently used item of frequent.
+func (c *Cache) RemoveOldest() {
+	c.removeOldest(false)
+}
+
+func (c *Cache) removeOldest(ghostHit bool) {
+	if q := c.victim(ghostHit); q != nil {
+		c.evict(q, q.Back(), lru.EvictCapacity)
+	}
+}
+
+// victim 返回下一个被淘汰的节点所在的链表
+func (c *Cache) victim(ghostHit bool) *queue.Queue {
+	n := c.recent.Bytes()
+	if c.recent.Len() > 0 && (n > c.recentBytes || (n == c.recentBytes && !ghostHit) || c.frequent.Len() == 0) {
+		return c.recent
+	} else if c.frequent.Len() > 0 {
+		return c.frequent
+	}
+	return nil
+}
+
+// Contains reports whether key is cached in recent or frequent, without
+// promoting it. Keys only remembered in ghost are not cached.
+func (c *Cache) Contains(key string) bool {
+	_, ok1 := c.recent.Lookup(key)
+	_, ok2 := c.frequent.Lookup(key)
+	return ok1 || ok2
+}
+
+// Victim returns the key RemoveOldest would evict next.
+func (c *Cache) Victim() (key string, ok bool) {
+	if q := c.victim(false); q != nil {
+		return q.Back().Value.(*queue.Entry).Key, true
+	}
+	return "", false
+}
+
+func (c *Cache) trim() {
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.Len() > 0 && c.Bytes() > c.maxBytes {
+		c.removeOldest(false)
+	}
+	for c.ghost.Len() > 0 && c.ghost.Bytes() > c.ghostBytes {
+		c.ghost.Remove(c.ghost.Back())
+	}
+}
+
+// evict 将常驻节点移出 q，从 recent 因容量淘汰的键会记录到 ghost
+func (c *Cache) evict(q *queue.Queue, ele *list.Element, reason lru.EvictReason) {
+	e := q.Remove(ele)
+	if reason == lru.EvictCapacity && q == c.recent {
+		c.ghost.PushFront(&queue.Entry{Key: e.Key, Size: e.Size})
+	}
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.Key, e.Value, reason)
+	}
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.ghost.Lookup(key); ok {
+		c.ghost.Remove(ele)
+	}
+	if ele, ok := c.frequent.Lookup(key); ok {
+		c.evict(c.frequent, ele, lru.EvictRemoved)
+		return true
+	}
+	if ele, ok := c.recent.Lookup(key); ok {
+		c.evict(c.recent, ele, lru.EvictRemoved)
+		return true
+	}
+	return false
+}
+
+// RemoveExpired removes all expired items and returns how many were removed.
+func (c *Cache) RemoveExpired() int {
+	now := c.now()
+	n := 0
+	for _, q := range []*queue.Queue{c.recent, c.frequent} {
+		for ele := q.Back(); ele != nil; {
+			prev := ele.Prev()
+			if ele.Value.(*queue.Entry).Expired(now) {
+				c.evict(q, ele, lru.EvictExpired)
+				n++
+			}
+			ele = prev
+		}
+	}
+	return n
+}
+
+// Len the number of cache entries
+func (c *Cache) Len() int {
+	return c.recent.Len() + c.frequent.Len()
+}
+
+// Bytes returns the number of bytes used by keys and values.
+func (c *Cache) Bytes() int64 {
+	return c.recent.Bytes() + c.frequent.Bytes()
+}
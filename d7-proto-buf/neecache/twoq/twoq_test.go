@@ -0,0 +1,151 @@
+package twoq
+
+import (
+	"fmt"
+	"neecache/internal/queue"
+	"neecache/lru"
+	"reflect"
+	"testing"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+// newTestCache 每个节点 4 字节，recent 的目标为 10 字节，ghost 最多记录 20 字节
+func newTestCache(evicted *[]string) *Cache {
+	return NewWithRatio(40, 0.25, 0.5, func(key string, value lru.Value, reason lru.EvictReason) {
+		*evicted = append(*evicted, key)
+	})
+}
+
+func (c *Cache) keys(q *queue.Queue) []string {
+	keys := make([]string, 0, q.Len())
+	for ele := q.Front(); ele != nil; ele = ele.Next() {
+		keys = append(keys, ele.Value.(*queue.Entry).Key)
+	}
+	return keys
+}
+
+func TestRecentFIFO(t *testing.T) {
+	var evicted []string
+	c := newTestCache(&evicted)
+	c.Add("k1", String("v1"))
+	c.Add("k2", String("v2"))
+	c.Add("k3", String("v3"))
+	if got := c.keys(c.recent); !reflect.DeepEqual(got, []string{"k3", "k2", "k1"}) || c.frequent.Len() != 0 {
+		t.Fatalf("new keys should enter recent only, got %v", got)
+	}
+	// recent 超过目标大小，按加入的顺序淘汰
+	c.RemoveOldest()
+	c.RemoveOldest()
+	if !reflect.DeepEqual(evicted, []string{"k1", "k2"}) {
+		t.Fatalf("recent should evict in FIFO order, got %v", evicted)
+	}
+	if got := c.keys(c.ghost); !reflect.DeepEqual(got, []string{"k2", "k1"}) {
+		t.Fatalf("keys evicted from recent should be remembered in ghost, got %v", got)
+	}
+}
+
+func TestRecentPromotion(t *testing.T) {
+	var evicted []string
+	c := newTestCache(&evicted)
+	c.Add("k1", String("v1"))
+	c.Add("k2", String("v2"))
+	c.Get("k1")
+	// 已在 recent 中的 key 再次写入同样视为第二次访问
+	c.Add("k2", String("v2"))
+	if c.recent.Len() != 0 || !reflect.DeepEqual(c.keys(c.frequent), []string{"k2", "k1"}) {
+		t.Fatalf("second access should promote to frequent, recent %v frequent %v", c.keys(c.recent), c.keys(c.frequent))
+	}
+}
+
+func TestGhostPromotion(t *testing.T) {
+	var evicted []string
+	c := newTestCache(&evicted)
+	c.Add("k1", String("v1"))
+	c.RemoveOldest()
+	if _, ok := c.ghost.Lookup("k1"); !ok || c.Len() != 0 {
+		t.Fatalf("k1 should be in ghost only")
+	}
+	if _, ok := c.Get("k1"); ok {
+		t.Fatalf("ghost keys hold no value")
+	}
+	// 近期淘汰过的 key 再次加入时直接进入 frequent
+	c.Add("k1", String("v1"))
+	if _, ok := c.frequent.Lookup("k1"); !ok || c.recent.Len() != 0 || c.ghost.Len() != 0 {
+		t.Fatalf("k1 should move from ghost to frequent")
+	}
+	// 从 frequent 淘汰的 key 不记录到 ghost
+	c.RemoveOldest()
+	if c.ghost.Len() != 0 || !reflect.DeepEqual(evicted, []string{"k1", "k1"}) {
+		t.Fatalf("keys evicted from frequent should not be remembered, ghost %v", c.keys(c.ghost))
+	}
+}
+
+func TestFrequentLRU(t *testing.T) {
+	var evicted []string
+	c := newTestCache(&evicted)
+	for _, key := range []string{"k1", "k2", "k3"} {
+		c.Add(key, String("v1"))
+		c.Get(key)
+	}
+	c.Get("k1")
+	if key, ok := c.Victim(); !ok || key != "k2" {
+		t.Fatalf("frequent should evict the least recently used k2, got %s", key)
+	}
+	c.RemoveOldest()
+	if !reflect.DeepEqual(c.keys(c.frequent), []string{"k1", "k3"}) {
+		t.Fatalf("unexpected frequent %v", c.keys(c.frequent))
+	}
+}
+
+func TestGhostBounded(t *testing.T) {
+	var evicted []string
+	c := newTestCache(&evicted)
+	for i := 0; i < 30; i++ {
+		c.Add(fmt.Sprintf("k%02d", i), String("v"))
+	}
+	if c.ghost.Bytes() > c.ghostBytes || c.ghost.Len() == 0 {
+		t.Fatalf("ghost should hold at most %d bytes, got %d", c.ghostBytes, c.ghost.Bytes())
+	}
+	if c.Bytes() > c.maxBytes {
+		t.Fatalf("now: %d, max: %d", c.Bytes(), c.maxBytes)
+	}
+}
+
+func TestRemoveForgetsGhost(t *testing.T) {
+	var evicted []string
+	c := newTestCache(&evicted)
+	c.Add("k1", String("v1"))
+	c.RemoveOldest()
+	if c.Remove("k1") {
+		t.Fatalf("k1 is not cached")
+	}
+	c.Add("k1", String("v1"))
+	if _, ok := c.recent.Lookup("k1"); !ok {
+		t.Fatalf("removed key should start over in recent")
+	}
+}
+
+func TestScanResistant(t *testing.T) {
+	c := New(int64(len("hot0value")*20), nil)
+	// 访问两次的热点数据
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("hot%d", i)
+		c.Add(key, String("value"))
+		c.Get(key)
+	}
+	// 一次性的大范围扫描
+	for i := 0; i < 100; i++ {
+		c.Add(fmt.Sprintf("s%03d", i), String("value"))
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, ok := c.Get(fmt.Sprintf("hot%d", i)); !ok {
+			t.Fatalf("hot%d should survive the scan", i)
+		}
+	}
+}
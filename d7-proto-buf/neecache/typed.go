@@ -0,0 +1,146 @@
+package neecache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// A Codec encodes values of type T into the bytes cached by a Group.
+// It must be safe for concurrent use.
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec encodes values with encoding/json.
+type JSONCodec[T any] struct{}
+
+// Encode implements Codec.
+func (JSONCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Decode implements Codec.
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// GobCodec encodes values with encoding/gob.
+// 每个值独立编码，包含完整的类型信息，适合字段较多的结构体
+type GobCodec[T any] struct{}
+
+// Encode implements Codec.
+func (GobCodec[T]) Encode(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode implements Codec.
+func (GobCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// ProtoCodec encodes protobuf messages, T is a pointer to a generated
+// message type such as *neecachepb.Request.
+type ProtoCodec[T proto.Message] struct{}
+
+// Encode implements Codec.
+func (ProtoCodec[T]) Encode(v T) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+// Decode implements Codec.
+func (ProtoCodec[T]) Decode(data []byte) (T, error) {
+	// 通过 T 的零值(nil 指针)取得消息类型，再创建新的消息
+	var zero T
+	v := zero.ProtoReflect().Type().New().Interface().(T)
+	err := proto.Unmarshal(data, v)
+	return v, err
+}
+
+// A TypedGetter loads the value of type T for a key.
+type TypedGetter[T any] interface {
+	Get(ctx context.Context, key string) (T, error)
+}
+
+// A TypedGetterFunc implements TypedGetter with a function.
+type TypedGetterFunc[T any] func(ctx context.Context, key string) (T, error)
+
+// Get implements TypedGetter interface function
+func (f TypedGetterFunc[T]) Get(ctx context.Context, key string) (T, error) {
+	return f(ctx, key)
+}
+
+// A TypedGroup is a Group of values of type T. Values returned by the getter
+// are encoded once with the codec before they are cached or sent to peers,
+// Get decodes them again.
+// 所有节点的同名 TypedGroup 必须使用相同的 Codec
+type TypedGroup[T any] struct {
+	group *Group
+	codec Codec[T]
+}
+
+// NewTypedGroup creates a TypedGroup in the default registry, opts configure
+// the underlying Group as for NewGroupWithOptions.
+func NewTypedGroup[T any](name string, codec Codec[T], getter TypedGetter[T], opts ...Option) (*TypedGroup[T], error) {
+	return NewTypedGroupIn(DefaultRegistry, name, codec, getter, opts...)
+}
+
+// NewTypedGroupIn is like NewTypedGroup, the group is created in r.
+func NewTypedGroupIn[T any](r *Registry, name string, codec Codec[T], getter TypedGetter[T], opts ...Option) (*TypedGroup[T], error) {
+	g, err := r.NewGroupCtx(name, GetterCtxFunc(func(ctx context.Context, key string) ([]byte, error) {
+		v, err := getter.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return codec.Encode(v)
+	}), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedGroup[T]{group: g, codec: codec}, nil
+}
+
+// Group returns the underlying Group, e.g. to register peers or read its Stats.
+func (t *TypedGroup[T]) Group() *Group {
+	return t.group
+}
+
+// Get returns the decoded value for key, see Group.GetContext.
+func (t *TypedGroup[T]) Get(ctx context.Context, key string) (T, error) {
+	var zero T
+	view, err := t.group.GetContext(ctx, key)
+	if err != nil {
+		return zero, err
+	}
+	b, err := view.bytes()
+	if err != nil {
+		return zero, err
+	}
+	return t.codec.Decode(b)
+}
+
+// Set encodes v and stores it for key, see Group.Set.
+func (t *TypedGroup[T]) Set(key string, v T) error {
+	data, err := t.codec.Encode(v)
+	if err != nil {
+		return err
+	}
+	return t.group.Set(key, data)
+}
+
+// Remove removes key from the cache, see Group.Remove.
+func (t *TypedGroup[T]) Remove(key string) error {
+	return t.group.Remove(key)
+}
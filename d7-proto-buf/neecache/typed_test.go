@@ -0,0 +1,83 @@
+package neecache
+
+import (
+	"context"
+	"errors"
+	"neecache/neecachepb"
+	"reflect"
+	"testing"
+)
+
+type student struct {
+	Name  string
+	Score int
+}
+
+func TestCodecs(t *testing.T) {
+	tom := student{Name: "Tom", Score: 630}
+	for name, codec := range map[string]Codec[student]{"json": JSONCodec[student]{}, "gob": GobCodec[student]{}} {
+		data, err := codec.Encode(tom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, err := codec.Decode(data); err != nil || v != tom {
+			t.Fatalf("%s: round trip got %v, %v", name, v, err)
+		}
+	}
+
+	codec := ProtoCodec[*neecachepb.Request]{}
+	data, err := codec.Encode(&neecachepb.Request{Group: "scores", Key: "Tom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := codec.Decode(data); err != nil || v.GetGroup() != "scores" || v.GetKey() != "Tom" {
+		t.Fatalf("proto: round trip got %v, %v", v, err)
+	}
+}
+
+func TestTypedGroup(t *testing.T) {
+	db := map[string]student{"Tom": {"Tom", 630}, "Jack": {"Jack", 589}}
+	loadCounts := make(map[string]int)
+	scores, err := NewTypedGroupIn[student](NewRegistry(), "students", JSONCodec[student]{},
+		TypedGetterFunc[student](func(ctx context.Context, key string) (student, error) {
+			loadCounts[key]++
+			if v, ok := db[key]; ok {
+				return v, nil
+			}
+			return student{}, ErrNotFound
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if v, err := scores.Get(ctx, "Tom"); err != nil || v != db["Tom"] {
+			t.Fatalf("failed to get Tom: %v, %v", v, err)
+		}
+	}
+	if loadCounts["Tom"] != 1 {
+		t.Fatalf("cache Tom miss")
+	}
+	// 缓存的是编码后的数据
+	if view, _ := scores.Group().Get("Tom"); view.String() != `{"Name":"Tom","Score":630}` {
+		t.Fatalf("unexpected cached bytes %q", view.String())
+	}
+
+	if _, err := scores.Get(ctx, "unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	sam := student{"Sam", 701}
+	if err := scores.Set("Sam", sam); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := scores.Get(ctx, "Sam"); err != nil || !reflect.DeepEqual(v, sam) || loadCounts["Sam"] != 0 {
+		t.Fatalf("Set value should be served from the cache, got %v, %v", v, err)
+	}
+	if err := scores.Remove("Sam"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scores.Get(ctx, "Sam"); !errors.Is(err, ErrNotFound) || loadCounts["Sam"] != 1 {
+		t.Fatalf("removed value should be loaded again")
+	}
+}